@@ -0,0 +1,504 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ======== Add ========
+
+// addEntry — один исходный файл для добавления. Пустые Spec, Date и Name
+// берутся из флагов команды.
+type addEntry struct {
+	Path string
+	Spec string // как ввёл пользователь, после findSpec — отображаемое имя
+	Date string
+	Name string
+	// Slug — каталог специализации в foto/ и pdf/, заполняется findSpec.
+	Slug string
+	// NewSpec — специализации ещё нет в реестре; она регистрируется
+	// вместе с первым записанным документом.
+	NewSpec bool
+}
+
+// addOptions — общие для всех файлов пакета параметры add.
+type addOptions struct {
+	Title       string
+	Doctor      string
+	Clinic      string
+	Notes       string
+	Tags        []string
+	Attachments []string
+	Convert     ConvertOptions
+	// AllowDuplicate отключает проверку на дубликаты.
+	AllowDuplicate bool
+}
+
+// addTarget возвращает специализацию, префикс имени страниц, название
+// документа и дату для записи файла.
+func addTarget(e addEntry, o addOptions) (specSlug, nameSlug, title string, date time.Time, err error) {
+	date, _, err = ParseDate(e.Date)
+	if err != nil {
+		return "", "", "", time.Time{}, fmt.Errorf("неверный формат даты %q: %w", e.Date, err)
+	}
+	name := e.Name
+	if name == "" {
+		name = e.Spec
+	}
+	title = o.Title
+	if title == "" {
+		title = name
+	}
+	return e.Slug, Sanitize(name), title, date, nil
+}
+
+// Добавление идёт в два шага. Сначала файл конвертируется во временный
+// каталог foto/<spec>/.add-*, невидимый для манифеста и сборки PDF. Затем
+// страницы переименованиями переносятся в foto/<spec>/ и документ
+// записывается в манифест; при ошибке на любом шаге в foto/ ничего не
+// остаётся.
+
+// convertedEntry — файл, сконвертированный во временный каталог, но ещё не
+// перенесённый в foto/<spec>/.
+type convertedEntry struct {
+	SpecSlug  string
+	NameSlug  string
+	Title     string
+	Date      time.Time
+	Checksum  string
+	Converter string
+	Staging   string // временный каталог со страницами
+	Pages     []ConvertedPage
+	Sums      []string // SHA-256 страниц
+	Hashes    []string // dHash страниц ("" — не удалось посчитать)
+}
+
+// discard удаляет временный каталог вместе со страницами.
+func (c *convertedEntry) discard() {
+	if err := os.RemoveAll(c.Staging); err != nil {
+		log.Printf("Предупреждение: не удалось удалить %s: %v\n", c.Staging, err)
+	}
+}
+
+// convertEntry конвертирует один файл во временный каталог и считает
+// контрольные суммы. Ничего не пишет в лог и в манифест, поэтому безопасна
+// для запуска в нескольких горутинах. Файлы, чья контрольная сумма есть в
+// existing, не конвертируются. Конвертация ограничена convertTimeout; при
+// ошибке или отмене ctx временный каталог удаляется.
+func convertEntry(ctx context.Context, e addEntry, o addOptions, existing map[string]docMatch) (*convertedEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	specSlug, nameSlug, title, date, err := addTarget(e, o)
+	if err != nil {
+		return nil, err
+	}
+	checksum, err := fileSHA256(e.Path)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := existing[checksum]; ok {
+		return nil, duplicateError(m)
+	}
+	fotoDir := filepath.Join(baseFotoDir, specSlug)
+	if err := os.MkdirAll(fotoDir, 0o755); err != nil {
+		return nil, fmt.Errorf("не удалось создать директорию %s: %w", fotoDir, err)
+	}
+	if err := os.MkdirAll(filepath.Join(basePDFDir, specSlug), 0o755); err != nil {
+		return nil, fmt.Errorf("не удалось создать директорию pdf/%s: %w", specSlug, err)
+	}
+	staging, err := os.MkdirTemp(fotoDir, ".add-")
+	if err != nil {
+		return nil, err
+	}
+	c := &convertedEntry{
+		SpecSlug: specSlug,
+		NameSlug: nameSlug,
+		Title:    title,
+		Date:     date,
+		Checksum: checksum,
+		Staging:  staging,
+	}
+	if err := c.convert(ctx, e.Path, o.Convert); err != nil {
+		c.discard()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *convertedEntry) convert(ctx context.Context, src string, opt ConvertOptions) error {
+	var err error
+	cctx, cancel := withConvertTimeout(ctx)
+	baseName := fmt.Sprintf("%s_%s", c.NameSlug, c.Date.Format("02_01_2006"))
+	c.Pages, c.Converter, err = ConvertSource(cctx, src, c.Staging, baseName, opt)
+	cancel()
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("конвертация не уложилась в %s (--timeout): %w", convertTimeout, err)
+	}
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, p := range c.Pages {
+		_ = os.Chtimes(p.Path, time.Now(), c.Date)
+		sum, err := fileSHA256(p.Path)
+		if err != nil {
+			return err
+		}
+		c.Sums = append(c.Sums, sum)
+		hash := ""
+		if h, err := imageDHash(p.Path); err == nil {
+			hash = formatDHash(h)
+		}
+		c.Hashes = append(c.Hashes, hash)
+	}
+	return nil
+}
+
+// commitEntry переносит страницы из временного каталога в foto/<spec>/,
+// сохраняет оригинал и вложения и записывает документ в манифест. Если
+// что-то не удалось, перенесённые страницы удаляются. PDF не
+// перегенерируется.
+func commitEntry(e addEntry, o addOptions, c *convertedEntry) (Document, error) {
+	defer c.discard()
+	fotoDir := filepath.Join(baseFotoDir, c.SpecSlug)
+
+	staged := make([]Page, len(c.Pages))
+	for i, p := range c.Pages {
+		staged[i] = Page{File: filepath.Base(p.Path), Checksum: c.Sums[i], Caption: p.Caption, DHash: c.Hashes[i]}
+	}
+	names, err := planPageNames(c.Staging, fotoDir, staged, FormatDate(c.Date), c.NameSlug)
+	if err != nil {
+		return Document{}, err
+	}
+	if err := movePages(c.Staging, fotoDir, staged, names); err != nil {
+		return Document{}, fmt.Errorf("не удалось перенести страницы в %s: %w", fotoDir, err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			removePageFiles(fotoDir, names)
+		}
+	}()
+
+	log.Printf("Конвертер: %s\n", c.Converter)
+	for _, name := range names {
+		log.Printf("Добавлено: %s\n", filepath.Join(fotoDir, name))
+	}
+
+	original, err := StoreOriginal(baseOriginalsDir, e.Path, c.Checksum)
+	if err != nil {
+		return Document{}, err
+	}
+	var attachments []StoredFile
+	for _, f := range o.Attachments {
+		sum, err := fileSHA256(f)
+		if err != nil {
+			return Document{}, err
+		}
+		rel, err := StoreOriginal(baseOriginalsDir, f, sum)
+		if err != nil {
+			return Document{}, err
+		}
+		attachments = append(attachments, StoredFile{Name: filepath.Base(f), Path: rel})
+	}
+
+	doc := Document{
+		ID:           newDocID(),
+		Title:        c.Title,
+		Date:         FormatDate(c.Date),
+		SourceName:   filepath.Base(e.Path),
+		SourceFormat: strings.TrimPrefix(strings.ToLower(filepath.Ext(e.Path)), "."),
+		Doctor:       o.Doctor,
+		Clinic:       o.Clinic,
+		Notes:        o.Notes,
+		Tags:         normalizeTags(o.Tags),
+		Checksum:     c.Checksum,
+		Original:     original,
+		Attachments:  attachments,
+		Converter:    c.Converter,
+		AddedAt:      time.Now(),
+	}
+	for i, p := range staged {
+		p.File = names[i]
+		doc.Pages = append(doc.Pages, p)
+	}
+	err = UpdateManifest(fotoDir, func(m *Manifest) error {
+		m.Documents = append(m.Documents, doc)
+		return nil
+	})
+	if err != nil {
+		return Document{}, fmt.Errorf("не удалось обновить манифест: %w", err)
+	}
+	committed = true
+	if e.NewSpec {
+		if err := registerSpec(SpecEntry{Name: e.Spec, Slug: e.Slug}); err != nil {
+			log.Printf("Предупреждение: специализация %s не записана в реестр: %v\n", e.Spec, err)
+		}
+	}
+	return doc, nil
+}
+
+// removePageFiles удаляет страницы документа из каталога специализации.
+func removePageFiles(dir string, names []string) {
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Предупреждение: не удалось удалить %s: %v\n", path, err)
+		}
+	}
+}
+
+// rollbackEntries убирает только что добавленные документы из манифестов и
+// удаляет их страницы. Оригиналы остаются в originals/ — их, если они
+// больше не нужны, удалит pdfmed trash empty.
+func rollbackEntries(added []docMatch) {
+	for _, m := range added {
+		dir := m.Dir(baseFotoDir)
+		names := make([]string, len(m.Doc.Pages))
+		for i, p := range m.Doc.Pages {
+			names[i] = p.File
+		}
+		// Сначала страницы: иначе сверка манифеста с каталогом вернула бы
+		// их обратно как новый документ.
+		removePageFiles(dir, names)
+		err := UpdateManifest(dir, func(man *Manifest) error {
+			man.Documents = removeDocument(man.Documents, m.Doc.ID)
+			return nil
+		})
+		if err != nil {
+			log.Printf("Предупреждение: не удалось убрать документ %s из манифеста: %v\n", m.Doc.ID, err)
+		}
+	}
+}
+
+// forgetNewSpecs убирает специализации, созданные этим add, в которые в
+// итоге ничего не добавлено (все файлы не сконвертировались или добавление
+// откатили): каталоги в foto/ и pdf/ и запись в реестре. Убранные
+// специализации удаляются и из affected.
+func forgetNewSpecs(entries []addEntry, affected map[string]bool) {
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if !e.NewSpec || seen[e.Slug] {
+			continue
+		}
+		seen[e.Slug] = true
+		dir := filepath.Join(baseFotoDir, e.Slug)
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		m, _, err := ReadManifest(dir)
+		if err != nil || len(m.Documents) > 0 {
+			continue
+		}
+		_ = os.Remove(filepath.Join(dir, manifestFileName))
+		if err := os.Remove(dir); err != nil {
+			log.Printf("Предупреждение: не удалось удалить %s: %v\n", dir, err)
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(basePDFDir, e.Slug)); err != nil {
+			log.Printf("Предупреждение: %v\n", err)
+		}
+		if err := unregisterSpec(e.Slug); err != nil {
+			log.Printf("Предупреждение: специализация %s не убрана из реестра: %v\n", e.Spec, err)
+		}
+		delete(affected, e.Slug)
+	}
+}
+
+// addEntries конвертирует файлы параллельно (до jobs одновременно) и
+// переносит их в архив по одному, в порядке списка, — поэтому суффиксы
+// _02, _03 у одноимённых файлов не зависят от того, какая конвертация
+// завершилась раньше. Без o.AllowDuplicate файлы, уже лежащие в архиве
+// (или раньше в этом же списке), не добавляются, а о похожих страницах
+// выводится предупреждение. После отмены ctx (Ctrl-C) новые документы в
+// архив не переносятся, а уже перенесённые откатывает вызывающий.
+// Возвращает добавленные документы и число незаписанных файлов.
+func addEntries(ctx context.Context, entries []addEntry, o addOptions) ([]docMatch, int) {
+	var (
+		idx      *duplicateIndex
+		existing map[string]docMatch // только для чтения из горутин конвертации
+	)
+	if !o.AllowDuplicate {
+		var err error
+		if idx, err = loadDuplicateIndex(baseFotoDir); err != nil {
+			log.Fatalf("Не удалось прочитать архив: %v", err)
+		}
+		existing = maps.Clone(idx.sums)
+	}
+	converted := make([]*convertedEntry, len(entries))
+	var added []docMatch
+	failed := 0
+	runJobs(len(entries), func(i int) error {
+		c, err := convertEntry(ctx, entries[i], o, existing)
+		converted[i] = c
+		return err
+	}, func(i int, err error) {
+		e := entries[i]
+		if ctx.Err() != nil {
+			if converted[i] != nil {
+				converted[i].discard()
+			}
+			failed++
+			return
+		}
+		if len(entries) > 1 {
+			log.Printf("[%d/%d] %s\n", i+1, len(entries), e.Path)
+		}
+		if err == nil && idx != nil {
+			if m, ok := idx.exact(converted[i].Checksum); ok {
+				converted[i].discard()
+				err = duplicateError(m)
+			}
+		}
+		var doc Document
+		if err == nil {
+			doc, err = commitEntry(e, o, converted[i])
+		}
+		if err != nil {
+			log.Printf("Ошибка: %s: %v\n", e.Path, err)
+			failed++
+			return
+		}
+		m := docMatch{Spec: converted[i].SpecSlug, Doc: doc}
+		added = append(added, m)
+		log.Printf("Документ %s записан в манифест.\n", doc.ID)
+		if idx != nil {
+			for _, s := range idx.similar(doc.Pages) {
+				log.Printf("Предупреждение: документ %s похож на %s. Если это дубликат: pdfmed remove --id %s\n", doc.ID, s, doc.ID)
+			}
+			idx.add(m)
+		}
+	})
+	return added, failed
+}
+
+// expandSources превращает пути из -p и аргументов в список файлов:
+// каталоги раскрываются (с recursive — вместе с подкаталогами), в них
+// берутся только поддерживаемые форматы. Glob-шаблоны раскрываются,
+// если оболочка этого не сделала.
+func expandSources(paths []string, recursive bool) ([]string, error) {
+	var out []string
+	for _, p := range paths {
+		matches := []string{p}
+		if strings.ContainsAny(p, "*?[") {
+			m, err := filepath.Glob(p)
+			if err != nil {
+				return nil, fmt.Errorf("неверный шаблон %s: %w", p, err)
+			}
+			if len(m) == 0 {
+				return nil, fmt.Errorf("по шаблону %s ничего не найдено", p)
+			}
+			matches = m
+		}
+		for _, m := range matches {
+			info, err := os.Stat(m)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				out = append(out, m)
+				continue
+			}
+			files, err := sourcesInDir(m, recursive)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, files...)
+		}
+	}
+	return out, nil
+}
+
+func sourcesInDir(dir string, recursive bool) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != dir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if path != dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isSupportedSource(strings.ToLower(filepath.Ext(path))) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// isSupportedSource — расширения, которые add берёт из каталогов.
+func isSupportedSource(ext string) bool {
+	switch ext {
+	case ".jpg", ".jpeg", ".png", ".gif", ".bmp", ".tif", ".tiff", ".webp",
+		".heic", ".heif", ".heics", ".pdf":
+		return true
+	}
+	return isVideoExt(ext)
+}
+
+// readListFile читает список файлов: по одному пути в строке или CSV
+// path,spec,date,name (необязательные поля можно опустить). Строки с # —
+// комментарии. Относительные пути считаются от каталога списка.
+func readListFile(path string) ([]addEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	base := filepath.Dir(path)
+	var entries []addEntry
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(rec) == 0 || strings.TrimSpace(rec[0]) == "" {
+			continue
+		}
+		if len(rec) > 4 {
+			line, _ := r.FieldPos(0)
+			return nil, fmt.Errorf("%s:%d: ожидалось не более 4 полей (path,spec,date,name)", path, line)
+		}
+		field := func(i int) string {
+			if i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		p := field(0)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(base, p)
+		}
+		entries = append(entries, addEntry{Path: p, Spec: field(1), Date: field(2), Name: field(3)})
+	}
+	return entries, nil
+}
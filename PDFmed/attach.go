@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gofpdf "github.com/phpdave11/gofpdf"
+)
+
+// ======== Вложения ========
+
+// attachOriginals — глобальное значение по умолчанию для встраивания
+// оригиналов в PDF. Манифест специализации может его переопределить.
+var attachOriginals = os.Getenv("PDFMED_ATTACH_ORIGINALS") == "1"
+
+// StoredFile — файл в хранилище originals/, прикреплённый к документу.
+type StoredFile struct {
+	Name string `json:"name"` // исходное имя файла
+	Path string `json:"path"` // путь относительно originals/
+}
+
+// stringsFlag — повторяемый строковый флаг.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string { return strings.Join(*s, ",") }
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// attachEnabled сообщает, нужно ли встраивать оригиналы в PDF специализации.
+func (m *Manifest) attachEnabled() bool {
+	if m.AttachOriginals != nil {
+		return *m.AttachOriginals
+	}
+	return attachOriginals
+}
+
+// attachConfigured — attachEnabled без учёта разового флага --attach.
+func (m *Manifest) attachConfigured() bool {
+	if m.AttachOriginals != nil {
+		return *m.AttachOriginals
+	}
+	return configAttach
+}
+
+// documentFiles возвращает оригинал документа и дополнительные вложения.
+func documentFiles(d *Document) []StoredFile {
+	var files []StoredFile
+	if d.Original != "" {
+		name := d.SourceName
+		if name == "" {
+			name = filepath.Base(d.Original)
+		}
+		files = append(files, StoredFile{Name: name, Path: d.Original})
+	}
+	return append(files, d.Attachments...)
+}
+
+// annotateAttachments встраивает файлы документа в PDF и размещает значки
+// вложений в верхнем поле текущей страницы, справа налево.
+func annotateAttachments(pdf *gofpdf.Fpdf, d *Document, originalsBase string, pageW, margin float64) {
+	const w, h = 12.0, 5.0
+	x := pageW - margin - w
+	y := (margin - h) / 2
+	for _, f := range documentFiles(d) {
+		data, err := os.ReadFile(filepath.Join(originalsBase, f.Path))
+		if err != nil {
+			log.Printf("Предупреждение: вложение %s пропущено: %v\n", f.Name, err)
+			continue
+		}
+		label := strings.ToUpper(strings.TrimPrefix(filepath.Ext(f.Name), "."))
+		if label == "" {
+			label = "FILE"
+		}
+		pdf.SetFont(pdfFont, "", 7)
+		pdf.SetDrawColor(90, 90, 90)
+		pdf.SetXY(x, y)
+		pdf.CellFormat(w, h, label, "1", 0, "C", false, 0, "")
+		pdf.AddAttachmentAnnotation(&gofpdf.Attachment{
+			Content:     data,
+			Filename:    f.Name,
+			Description: fmt.Sprintf("%s, %s", d.Title, d.Date),
+		}, x, y, w, h)
+		x -= w + 2
+	}
+}
+
+func runAttach(args []string) {
+	fs := flag.NewFlagSet("attach", flag.ExitOnError)
+	var spec string
+	fs.StringVar(&spec, "s", "", "специализация")
+	fs.StringVar(&spec, "spec", "", "специализация")
+	patient := patientFlag(fs)
+	mode := parseWithLeadingArg(fs, args)
+	usePatient(*patient, false)
+
+	if spec == "" {
+		log.Println("Ошибка: укажите -s. Для всех специализаций используйте PDFMED_ATTACH_ORIGINALS=1 или regen --attach.")
+		fs.Usage()
+		os.Exit(1)
+	}
+	var value *bool
+	switch mode {
+	case "on":
+		v := true
+		value = &v
+	case "off":
+		v := false
+		value = &v
+	case "default":
+	default:
+		log.Println("Ошибка: ожидается on, off или default.")
+		os.Exit(1)
+	}
+
+	specSlug := resolveSpec(spec, false).Slug
+	dir := filepath.Join(baseFotoDir, specSlug)
+	if _, err := os.Stat(dir); err != nil {
+		log.Fatalf("Специализация %s не найдена", specSlug)
+	}
+	err := UpdateManifest(dir, func(m *Manifest) error {
+		m.AttachOriginals = value
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Не удалось обновить манифест: %v", err)
+	}
+	regenerateSpecs(map[string]bool{specSlug: true})
+	log.Println("Готово.")
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ======== Конфигурация ========
+
+// Файл конфигурации — строки «ключ = значение», комментарии начинаются с #.
+// Ищется по --config, затем $PDFMED_CONFIG, затем
+// $XDG_CONFIG_HOME/pdfmed/config (~/.config/pdfmed/config). Пример:
+//
+//	root = ~/Documents/med
+//	patient = anna
+//	quality = 90
+//	density = 200
+//	page_size = A4
+//	margin = 10
+//	jobs = 4
+//	timeout = 5m
+//	converters = go,magick,ffmpeg
+//	tool.magick = /opt/homebrew/bin/magick
+//
+// Переменные окружения (PDFMED_PATIENT, PDFMED_CONVERTERS и т.д.) важнее
+// файла, флаги команд — важнее всего.
+
+var (
+	pdfDensity = 300  // DPI растеризации PDF
+	pageSize   = "A4" // формат страницы gofpdf: A3, A4, A5, Letter, Legal
+	pageMargin = 10.0 // поля страницы, мм
+	toolPaths  = map[string]string{}
+)
+
+// toolPath возвращает путь к внешней утилите с учётом tool.<имя> из конфига.
+func toolPath(name string) string {
+	if p, ok := toolPaths[name]; ok {
+		return p
+	}
+	return name
+}
+
+// parseGlobalFlags разбирает общие флаги перед командой
+// («pdfmed --root ~/med list») и применяет конфигурацию. Возвращает
+// аргументы, начиная с имени команды.
+func parseGlobalFlags(args []string) ([]string, error) {
+	fs := flag.NewFlagSet("pdfmed", flag.ContinueOnError)
+	fs.SetOutput(io.Discard) // справку и ошибки выводит main
+	var cfgPath, root string
+	fs.StringVar(&cfgPath, "config", "", "файл конфигурации")
+	fs.StringVar(&root, "root", "", "корень архива (по умолчанию — текущий каталог)")
+	var wait bool
+	fs.BoolVar(&wait, "wait", false, "ждать, пока другой запуск pdfmed освободит архив")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	explicit := cfgPath != ""
+	if cfgPath == "" {
+		cfgPath = defaultConfigPath()
+	}
+	if cfgPath != "" {
+		err := loadConfig(cfgPath)
+		if errors.Is(err, os.ErrNotExist) && !explicit && os.Getenv("PDFMED_CONFIG") == "" {
+			err = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if root != "" {
+		archiveRoot = expandHome(root)
+	}
+	if wait {
+		waitLock = true
+	}
+	return fs.Args(), nil
+}
+
+func defaultConfigPath() string {
+	if p := os.Getenv("PDFMED_CONFIG"); p != "" {
+		return p
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "pdfmed", "config")
+}
+
+// loadConfig читает файл конфигурации и применяет значения.
+func loadConfig(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: ожидалось «ключ = значение»", path, n)
+		}
+		key, value = strings.TrimSpace(key), strings.Trim(strings.TrimSpace(value), `"`)
+		if err := applyConfigValue(filepath.Dir(path), key, value); err != nil {
+			return fmt.Errorf("%s:%d: %s: %w", path, n, key, err)
+		}
+	}
+	return sc.Err()
+}
+
+func applyConfigValue(cfgDir, key, value string) error {
+	switch key {
+	case "root":
+		root := expandHome(value)
+		if !filepath.IsAbs(root) {
+			root = filepath.Join(cfgDir, root)
+		}
+		archiveRoot = root
+	case "patient":
+		if os.Getenv("PDFMED_PATIENT") == "" {
+			defaultPatient = value
+		}
+	case "quality":
+		q, err := strconv.Atoi(value)
+		if err != nil || q < 1 || q > 100 {
+			return fmt.Errorf("ожидалось число от 1 до 100")
+		}
+		jpegQuality = q
+	case "density":
+		d, err := strconv.Atoi(value)
+		if err != nil || d < 36 || d > 1200 {
+			return fmt.Errorf("ожидалось число от 36 до 1200")
+		}
+		pdfDensity = d
+	case "page_size":
+		switch strings.ToLower(value) {
+		case "a3", "a4", "a5", "letter", "legal":
+			pageSize = value
+		default:
+			return fmt.Errorf("неизвестный формат %q (A3, A4, A5, Letter, Legal)", value)
+		}
+	case "jobs":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("ожидалось положительное число")
+		}
+		if os.Getenv("PDFMED_JOBS") == "" {
+			jobs = n
+		}
+	case "timeout":
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return fmt.Errorf("ожидалась длительность, напр. 5m или 90s")
+		}
+		if os.Getenv("PDFMED_TIMEOUT") == "" {
+			convertTimeout = d
+		}
+	case "margin":
+		m, err := strconv.ParseFloat(value, 64)
+		if err != nil || m < 0 || m > 50 {
+			return fmt.Errorf("ожидалось число миллиметров от 0 до 50")
+		}
+		pageMargin = m
+	case "converters":
+		if os.Getenv("PDFMED_CONVERTERS") == "" {
+			converterOrder = splitList(value)
+		}
+	case "attach":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		if os.Getenv("PDFMED_ATTACH_ORIGINALS") == "" {
+			attachOriginals, configAttach = b, b
+		}
+	case "wait":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		if os.Getenv("PDFMED_WAIT") == "" {
+			waitLock = b
+		}
+	case "toc":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		if os.Getenv("PDFMED_TOC") == "" {
+			pdfTOC, configTOC = b, b
+		}
+	default:
+		tool, ok := strings.CutPrefix(key, "tool.")
+		if !ok || tool == "" {
+			return fmt.Errorf("неизвестный ключ")
+		}
+		toolPaths[tool] = expandHome(value)
+	}
+	return nil
+}
+
+func expandHome(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, p[1:])
+		}
+	}
+	return p
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"os"
+)
+
+// ======== Встроенная конвертация ========
+
+// jpegQuality — качество JPEG при конвертации (встроенной и ImageMagick).
+var jpegQuality = 85
+
+// convertNative декодирует изображение форматами, зарегистрированными в
+// пакете image (JPEG, PNG, GIF, BMP, TIFF, WebP), поворачивает его по EXIF
+// Orientation и сохраняет как JPEG. Для неизвестного формата возвращает
+// ошибку, оборачивающую image.ErrFormat. Отмена ctx проверяется перед
+// записью результата.
+func convertNative(ctx context.Context, src, dst string, quality int) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	img, _, err := image.Decode(bufio.NewReader(f))
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("не удалось декодировать %s: %w", src, err)
+	}
+	exif, _ := readEXIF(src)
+	img = applyOrientation(flattenImage(img), exif.Orientation())
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(out, img, &jpeg.Options{Quality: quality}); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return fmt.Errorf("не удалось закодировать JPEG: %w", err)
+	}
+	return out.Close()
+}
+
+// flattenImage переводит изображение в RGBA на белом фоне: в JPEG нет
+// прозрачности, а прозрачные области PNG иначе станут чёрными.
+func flattenImage(img image.Image) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
+
+// applyOrientation поворачивает и отражает изображение согласно EXIF
+// Orientation, чтобы результат отображался без учёта тега.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // отражение по горизонтали
+				dx, dy = w-1-x, y
+			case 3: // поворот на 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // отражение по вертикали
+				dx, dy = x, h-1-y
+			case 5: // транспонирование
+				dx, dy = y, x
+			case 6: // поворот на 90° по часовой
+				dx, dy = h-1-y, x
+			case 7: // поперечное отражение
+				dx, dy = h-1-y, w-1-x
+			case 8: // поворот на 90° против часовой
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ======== Конвертеры ========
+
+// Converter превращает исходный файл в одну или несколько JPG-страниц.
+type Converter interface {
+	// Name — имя конвертера для --converters и сообщений.
+	Name() string
+	// Available сообщает, можно ли использовать конвертер на этой машине.
+	Available() bool
+	// Accepts сообщает, берётся ли конвертер за файл с расширением ext
+	// (в нижнем регистре, с точкой) и MIME-типом, определённым по содержимому.
+	Accepts(ext, mime string) bool
+	// Convert пишет страницы в dstDir, называя их от baseName, и возвращает
+	// их в порядке следования. При отмене ctx внешние программы
+	// завершаются, а частично записанные страницы удаляются.
+	Convert(ctx context.Context, src, dstDir, baseName string, opt ConvertOptions) ([]ConvertedPage, error)
+}
+
+// ConvertOptions — параметры конвертации.
+type ConvertOptions struct {
+	Quality int             // качество JPEG, 1–100
+	Frames  int             // видео: число равномерно распределённых кадров
+	At      []time.Duration // видео: моменты кадров; приоритетнее Frames
+}
+
+// ConvertedPage — записанная JPG-страница и необязательная подпись к ней.
+type ConvertedPage struct {
+	Path    string
+	Caption string
+}
+
+func pathsToPages(paths []string) []ConvertedPage {
+	pages := make([]ConvertedPage, len(paths))
+	for i, p := range paths {
+		pages[i] = ConvertedPage{Path: p}
+	}
+	return pages
+}
+
+// defaultConverterOrder — порядок перебора конвертеров по умолчанию.
+var defaultConverterOrder = []string{"go", "magick", "convert", "heif-convert", "ffmpeg"}
+
+// converterOrder — текущий порядок (--converters или PDFMED_CONVERTERS).
+var converterOrder = envList("PDFMED_CONVERTERS", defaultConverterOrder)
+
+var converters = map[string]Converter{
+	"go":           nativeConverter{},
+	"magick":       magickConverter{bin: "magick"},
+	"convert":      magickConverter{bin: "convert"},
+	"heif-convert": heifConverter{},
+	"ffmpeg":       ffmpegConverter{},
+}
+
+// ConvertSource перебирает конвертеры в порядке converterOrder и возвращает
+// страницы от первого успешного вместе с его именем. Если ни один не
+// справился, ошибка содержит причины отказа каждого. После отмены ctx
+// следующие конвертеры не пробуются.
+func ConvertSource(ctx context.Context, src, dstDir, baseName string, opt ConvertOptions) ([]ConvertedPage, string, error) {
+	if err := os.MkdirAll(dstDir, 0o755); err != nil {
+		return nil, "", err
+	}
+	ext := strings.ToLower(filepath.Ext(src))
+	mime := sniffMIME(src)
+
+	var errs []error
+	for _, name := range converterOrder {
+		c, ok := converters[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: неизвестный конвертер", name))
+			continue
+		}
+		if !c.Accepts(ext, mime) {
+			continue
+		}
+		if !c.Available() {
+			errs = append(errs, fmt.Errorf("%s: не установлен", name))
+			continue
+		}
+		pages, err := c.Convert(ctx, src, dstDir, baseName, opt)
+		if err == nil {
+			return pages, name, nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", fmt.Errorf("%s: %w", name, ctx.Err())
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+	}
+	if len(errs) == 0 {
+		return nil, "", fmt.Errorf("нет конвертера для %s (%s)", filepath.Base(src), mime)
+	}
+	return nil, "", fmt.Errorf("не удалось сконвертировать %s:\n%w", filepath.Base(src), errors.Join(errs...))
+}
+
+func sniffMIME(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	return http.DetectContentType(buf[:n])
+}
+
+// singleOutput возвращает свободный путь <baseName>.jpg в dstDir.
+func singleOutput(dstDir, baseName string) (string, error) {
+	return EnsureUniquePath(filepath.Join(dstDir, baseName+".jpg"))
+}
+
+// multiOutputBase подбирает основу имени, для которой в dstDir ещё нет
+// страниц <base>_page_NNN.jpg, чтобы не смешать страницы разных документов.
+func multiOutputBase(dstDir, baseName string) (string, error) {
+	for i := 1; i < 1000; i++ {
+		base := baseName
+		if i > 1 {
+			base = fmt.Sprintf("%s_%02d", baseName, i)
+		}
+		existing, err := filepath.Glob(filepath.Join(dstDir, globEscape(base)+"_page_*.jpg"))
+		if err != nil {
+			return "", err
+		}
+		if len(existing) == 0 {
+			return base, nil
+		}
+	}
+	return "", fmt.Errorf("слишком много конфликтов имён для %s", baseName)
+}
+
+func collectPages(dstDir, base string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dstDir, globEscape(base)+"_page_*.jpg"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("не удалось найти JPG-страницы после конвертации")
+	}
+	return files, nil
+}
+
+func globEscape(s string) string {
+	r := strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`, `\`, `\\`)
+	return r.Replace(s)
+}
+
+func envList(key string, def []string) []string {
+	if v := os.Getenv(key); v != "" {
+		return splitList(v)
+	}
+	return def
+}
+
+// ---- go: встроенный конвертер ----
+
+type nativeConverter struct{}
+
+func (nativeConverter) Name() string    { return "go" }
+func (nativeConverter) Available() bool { return true }
+
+func (nativeConverter) Accepts(ext, mime string) bool {
+	switch ext {
+	case ".jpg", ".jpeg", ".png", ".gif", ".bmp", ".tif", ".tiff", ".webp":
+		return true
+	}
+	switch mime {
+	case "image/jpeg", "image/png", "image/gif", "image/bmp", "image/webp":
+		return true
+	}
+	return false
+}
+
+func (nativeConverter) Convert(ctx context.Context, src, dstDir, baseName string, opt ConvertOptions) ([]ConvertedPage, error) {
+	dst, err := singleOutput(dstDir, baseName)
+	if err != nil {
+		return nil, err
+	}
+	if err := convertNative(ctx, src, dst, opt.Quality); err != nil {
+		return nil, err
+	}
+	return pathsToPages([]string{dst}), nil
+}
+
+// ---- magick / convert: ImageMagick ----
+
+type magickConverter struct{ bin string }
+
+func (c magickConverter) Name() string    { return c.bin }
+func (c magickConverter) Available() bool { return haveCmd(c.bin) }
+
+func (magickConverter) Accepts(ext, mime string) bool {
+	return !isVideoExt(ext) && !strings.HasPrefix(mime, "video/")
+}
+
+func (c magickConverter) Convert(ctx context.Context, src, dstDir, baseName string, opt ConvertOptions) ([]ConvertedPage, error) {
+	quality := strconv.Itoa(opt.Quality)
+	if strings.ToLower(filepath.Ext(src)) == ".pdf" {
+		base, err := multiOutputBase(dstDir, baseName)
+		if err != nil {
+			return nil, err
+		}
+		pattern := filepath.Join(dstDir, base+"_page_%03d.jpg")
+		if err := runCmd(ctx, c.bin, "-density", strconv.Itoa(pdfDensity), src, "-quality", quality,
+			"-auto-orient", "-colorspace", "sRGB", "-strip", pattern); err != nil {
+			removePages(dstDir, base)
+			return nil, fmt.Errorf("ошибка конвертации PDF → JPG: %w", err)
+		}
+		paths, err := collectPages(dstDir, base)
+		if err != nil {
+			return nil, err
+		}
+		return pathsToPages(paths), nil
+	}
+	dst, err := singleOutput(dstDir, baseName)
+	if err != nil {
+		return nil, err
+	}
+	if err := runCmd(ctx, c.bin, src, "-auto-orient", "-strip", "-quality", quality, "-colorspace", "sRGB", dst); err != nil {
+		os.Remove(dst)
+		return nil, err
+	}
+	return pathsToPages([]string{dst}), nil
+}
+
+// removePages удаляет частично записанные страницы <base>_page_NNN.jpg.
+func removePages(dstDir, base string) {
+	files, _ := filepath.Glob(filepath.Join(dstDir, globEscape(base)+"_page_*.jpg"))
+	for _, f := range files {
+		if err := os.Remove(f); err != nil {
+			log.Printf("Предупреждение: не удалось удалить %s: %v\n", f, err)
+		}
+	}
+}
+
+// ---- heif-convert: libheif ----
+
+type heifConverter struct{}
+
+func (heifConverter) Name() string    { return "heif-convert" }
+func (heifConverter) Available() bool { return haveCmd("heif-convert") }
+
+func (heifConverter) Accepts(ext, mime string) bool {
+	return ext == ".heic" || ext == ".heif" || ext == ".heics"
+}
+
+func (heifConverter) Convert(ctx context.Context, src, dstDir, baseName string, opt ConvertOptions) ([]ConvertedPage, error) {
+	dst, err := singleOutput(dstDir, baseName)
+	if err != nil {
+		return nil, err
+	}
+	if err := runCmd(ctx, "heif-convert", "-q", strconv.Itoa(opt.Quality), src, dst); err != nil {
+		os.Remove(dst)
+		return nil, err
+	}
+	return pathsToPages([]string{dst}), nil
+}
+
+// ---- ffmpeg: видео ----
+
+// ffmpegConverter извлекает из видео кадры: в заданные моменты (At) или
+// Frames штук, равномерно по длительности. Каждый кадр становится страницей
+// с подписью-таймкодом.
+type ffmpegConverter struct{}
+
+func (ffmpegConverter) Name() string    { return "ffmpeg" }
+func (ffmpegConverter) Available() bool { return haveCmd("ffmpeg") }
+
+func (ffmpegConverter) Accepts(ext, mime string) bool {
+	return isVideoExt(ext) || strings.HasPrefix(mime, "video/")
+}
+
+func (ffmpegConverter) Convert(ctx context.Context, src, dstDir, baseName string, opt ConvertOptions) ([]ConvertedPage, error) {
+	duration, durErr := videoDuration(ctx, src)
+	at := opt.At
+	if len(at) == 0 {
+		n := opt.Frames
+		if n < 1 {
+			n = 1
+		}
+		if durErr != nil {
+			if n > 1 {
+				return nil, fmt.Errorf("не удалось определить длительность видео: %w", durErr)
+			}
+			at = []time.Duration{0}
+		} else {
+			for i := 0; i < n; i++ {
+				at = append(at, time.Duration(float64(duration)*(float64(i)+0.5)/float64(n)))
+			}
+		}
+	}
+	if durErr == nil {
+		for _, t := range at {
+			if t > duration {
+				return nil, fmt.Errorf("момент %s за пределами видео (%s)", formatTimestamp(t), formatTimestamp(duration))
+			}
+		}
+	}
+
+	var outputs []string
+	if len(at) == 1 {
+		dst, err := singleOutput(dstDir, baseName)
+		if err != nil {
+			return nil, err
+		}
+		outputs = []string{dst}
+	} else {
+		base, err := multiOutputBase(dstDir, baseName)
+		if err != nil {
+			return nil, err
+		}
+		for i := range at {
+			outputs = append(outputs, filepath.Join(dstDir, fmt.Sprintf("%s_page_%03d.jpg", base, i)))
+		}
+	}
+
+	// -q:v у ffmpeg: 2 (лучшее) … 31 (худшее).
+	qv := strconv.Itoa(2 + (100-opt.Quality)*29/100)
+	pages := make([]ConvertedPage, 0, len(at))
+	for i, t := range at {
+		ss := strconv.FormatFloat(t.Seconds(), 'f', 3, 64)
+		if err := runCmd(ctx, "ffmpeg", "-y", "-loglevel", "error", "-ss", ss, "-i", src, "-frames:v", "1", "-q:v", qv, outputs[i]); err != nil {
+			for _, o := range outputs {
+				os.Remove(o)
+			}
+			return nil, err
+		}
+		if _, err := os.Stat(outputs[i]); err != nil {
+			return nil, fmt.Errorf("ffmpeg не записал кадр %s", formatTimestamp(t))
+		}
+		caption := formatTimestamp(t)
+		if durErr == nil {
+			caption += " / " + formatTimestamp(duration)
+		}
+		pages = append(pages, ConvertedPage{Path: outputs[i], Caption: caption})
+	}
+	return pages, nil
+}
+
+// videoDuration возвращает длительность видео по данным ffprobe.
+func videoDuration(ctx context.Context, src string) (time.Duration, error) {
+	if !haveCmd("ffprobe") {
+		return 0, fmt.Errorf("ffprobe не найден")
+	}
+	cmd := exec.CommandContext(ctx, toolPath("ffprobe"), "-v", "error", "-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", src)
+	killGroupOnCancel(cmd)
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe: %w", err)
+	}
+	sec, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe: неожиданный ответ %q", strings.TrimSpace(string(out)))
+	}
+	return time.Duration(sec * float64(time.Second)), nil
+}
+
+// parseTimestamp разбирает момент видео: «SS», «SS.mmm», «MM:SS» или «HH:MM:SS».
+func parseTimestamp(s string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("неверный таймкод %q", s)
+	}
+	var total float64
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil || v < 0 || (i > 0 && v >= 60) {
+			return 0, fmt.Errorf("неверный таймкод %q", s)
+		}
+		total = total*60 + v
+	}
+	return time.Duration(total * float64(time.Second)), nil
+}
+
+// formatTimestamp форматирует момент видео как MM:SS или H:MM:SS.
+func formatTimestamp(d time.Duration) string {
+	sec := int(d.Round(time.Second) / time.Second)
+	if sec >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", sec/3600, sec%3600/60, sec%60)
+	}
+	return fmt.Sprintf("%02d:%02d", sec/60, sec%60)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/phpdave11/gofpdf"
+)
+
+// ======== Обложка и колонтитулы ========
+
+// coverInfo — данные для обложки PDF специализации.
+type coverInfo struct {
+	Patient   Profile
+	Spec      string
+	Details   []string
+	From, To  string // DD-MM-YYYY
+	Documents int
+	Pages     int
+	Generated time.Time
+}
+
+// drawCover добавляет страницу обложки.
+func drawCover(pdf *gofpdf.Fpdf, c coverInfo, pageW, pageH, margin float64) {
+	w := pageW - 2*margin
+	pdf.AddPage()
+	pdf.SetXY(margin, 70)
+	pdf.SetFont(pdfFont, "B", 24)
+	pdf.CellFormat(w, 12, "Медицинские документы", "", 2, "C", false, 0, "")
+	pdf.Ln(6)
+	if c.Patient.Name != "" {
+		pdf.SetFont(pdfFont, "B", 16)
+		pdf.CellFormat(w, 9, c.Patient.Name, "", 2, "C", false, 0, "")
+	}
+	pdf.SetFont(pdfFont, "", 12)
+	if c.Patient.BirthDate != "" {
+		pdf.CellFormat(w, 7, "Дата рождения: "+c.Patient.BirthDate, "", 2, "C", false, 0, "")
+	}
+	pdf.Ln(10)
+	pdf.SetFont(pdfFont, "B", 18)
+	pdf.CellFormat(w, 10, c.Spec, "", 2, "C", false, 0, "")
+	pdf.Ln(4)
+	pdf.SetFont(pdfFont, "", 12)
+	for _, line := range c.Details {
+		pdf.CellFormat(w, 7, line, "", 2, "C", false, 0, "")
+	}
+	if c.From != "" {
+		period := c.From
+		if c.To != c.From {
+			period += " — " + c.To
+		}
+		pdf.CellFormat(w, 7, "Период: "+period, "", 2, "C", false, 0, "")
+	}
+	pdf.CellFormat(w, 7, fmt.Sprintf("Документов: %d, страниц: %d", c.Documents, c.Pages), "", 2, "C", false, 0, "")
+
+	pdf.SetFont(pdfFont, "", 9)
+	pdf.SetTextColor(110, 110, 110)
+	pdf.SetXY(margin, pageH-margin-10)
+	pdf.CellFormat(w, 5, "Сформирован: "+c.Generated.Format("02-01-2006 15:04"), "", 0, "C", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+}
+
+// setupHeaderFooter назначает колонтитулы: сверху — дата и название текущего
+// документа (*cur) и, при showSpec, его специализация; снизу — «стр. X из Y».
+// Обложка (первая страница) остаётся без колонтитулов. headerW ограничивает
+// ширину верхнего колонтитула, чтобы он не налезал на значки вложений.
+func setupHeaderFooter(pdf *gofpdf.Fpdf, cur **fotoItem, showSpec bool, total int, pageW, pageH, margin, headerW float64) {
+	specNames := make(map[string]string)
+	pdf.SetHeaderFunc(func() {
+		it := *cur
+		if it == nil {
+			return
+		}
+		d := it.Doc
+		text := d.Date
+		if d.Title != "" {
+			text += " — " + d.Title
+		}
+		if showSpec {
+			name, ok := specNames[it.Spec]
+			if !ok {
+				name = specDisplayName(it.Spec)
+				specNames[it.Spec] = name
+			}
+			text += " · " + name
+		}
+		pdf.SetFont(pdfFont, "", 8)
+		pdf.SetTextColor(90, 90, 90)
+		pdf.SetXY(margin, (margin-5)/2)
+		pdf.CellFormat(headerW, 5, fitText(pdf, text, headerW), "", 0, "L", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+	})
+	pdf.SetFooterFunc(func() {
+		n := pdf.PageNo()
+		if n <= 1 {
+			return
+		}
+		pdf.SetFont(pdfFont, "", 8)
+		pdf.SetTextColor(90, 90, 90)
+		pdf.SetXY(pageW-margin-40, pageH-margin)
+		pdf.CellFormat(40, margin, fmt.Sprintf("стр. %d из %d", n, total), "", 0, "R", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+	})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ======== Определение даты ========
+
+// autoDate — значение -d, при котором дата определяется по файлу.
+const autoDate = "auto"
+
+// InferDate определяет дату документа: из EXIF (JPEG, HEIC, TIFF, WebP, PNG),
+// из CreationDate PDF или из имени файла. Второе значение описывает источник.
+// У видео дата берётся только из имени: MP4/MOV — тоже ISOBMFF, и искать
+// в них EXIF бессмысленно.
+func InferDate(path string) (time.Time, string, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch {
+	case ext == ".pdf":
+		if t, src, ok := pdfCreationDate(path); ok {
+			return t, src, nil
+		}
+	case isVideoExt(ext): // только имя файла
+	default:
+		if exif, err := readEXIF(path); err == nil {
+			if t, tag, ok := exif.DateTaken(); ok {
+				return t, "EXIF " + tag, nil
+			}
+		}
+	}
+	if t, ok := dateFromFileName(filepath.Base(path)); ok {
+		return t, "имя файла", nil
+	}
+	return time.Time{}, "", fmt.Errorf("не удалось определить дату %s: нет EXIF/метаданных и даты в имени", filepath.Base(path))
+}
+
+var (
+	pdfInfoDatePattern = regexp.MustCompile(`/CreationDate\s*\(D:(\d{4})(\d{2})(\d{2})`)
+	pdfXMPDatePattern  = regexp.MustCompile(`<xmp:CreateDate>(\d{4})-(\d{2})-(\d{2})`)
+)
+
+// pdfCreationDate ищет CreationDate в словаре Info или xmp:CreateDate в XMP.
+// Сжатые потоки объектов не распаковываются: Info почти всегда лежит открыто.
+func pdfCreationDate(path string) (time.Time, string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	for _, p := range []struct {
+		re   *regexp.Regexp
+		name string
+	}{
+		{pdfInfoDatePattern, "PDF CreationDate"},
+		{pdfXMPDatePattern, "PDF XMP CreateDate"},
+	} {
+		if m := p.re.FindSubmatch(data); m != nil {
+			if t, ok := makeDate(string(m[1]), string(m[2]), string(m[3])); ok {
+				return t, p.name, true
+			}
+		}
+	}
+	return time.Time{}, "", false
+}
+
+var fileNameDatePatterns = []struct {
+	re         *regexp.Regexp
+	y, mo, day int // номера групп
+}{
+	{regexp.MustCompile(`(?:^|\D)(\d{2})[_.\-](\d{2})[_.\-](\d{4})(?:\D|$)`), 3, 2, 1}, // DD_MM_YYYY, DD-MM-YYYY, DD.MM.YYYY
+	{regexp.MustCompile(`(?:^|\D)(\d{4})[_.\-](\d{2})[_.\-](\d{2})(?:\D|$)`), 1, 2, 3}, // YYYY-MM-DD
+	{regexp.MustCompile(`(?:^|\D)((?:19|20)\d{2})(\d{2})(\d{2})(?:\D|$)`), 1, 2, 3},    // IMG_20240101_...
+}
+
+// dateFromFileName ищет дату в имени файла в распространённых форматах.
+func dateFromFileName(name string) (time.Time, bool) {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	for _, p := range fileNameDatePatterns {
+		for _, m := range p.re.FindAllStringSubmatch(name, -1) {
+			if t, ok := makeDate(m[p.y], m[p.mo], m[p.day]); ok {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func makeDate(ys, ms, ds string) (time.Time, bool) {
+	y, _ := strconv.Atoi(ys)
+	mo, _ := strconv.Atoi(ms)
+	d, _ := strconv.Atoi(ds)
+	if y < 1900 || y > 2100 || mo < 1 || mo > 12 || d < 1 || d > 31 {
+		return time.Time{}, false
+	}
+	t := time.Date(y, time.Month(mo), d, 0, 0, 0, 0, time.UTC)
+	if t.Day() != d { // 31-02 и т.п.
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// isInteractive сообщает, подключён ли stdin к терминалу. /dev/null тоже
+// символьное устройство, поэтому его исключаем явно.
+func isInteractive() bool {
+	fi, err := os.Stdin.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	if null, err := os.Stat(os.DevNull); err == nil && os.SameFile(fi, null) {
+		return false
+	}
+	return true
+}
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// resolveAutoDate определяет дату файла и сообщает, откуда она взята.
+// В интерактивном режиме (и без confirmed) просит подтвердить или ввести
+// другую дату. Возвращает дату в формате DD-MM-YYYY.
+func resolveAutoDate(path string, confirmed bool) (string, error) {
+	t, source, err := InferDate(path)
+	interactive := isInteractive() && !confirmed
+	if err != nil {
+		if !interactive {
+			return "", err
+		}
+		log.Printf("%v\n", err)
+		return promptDate(fmt.Sprintf("Введите дату для %s (DD-MM-YYYY): ", filepath.Base(path)), "")
+	}
+	date := FormatDate(t)
+	log.Printf("Дата %s: %s (источник: %s)\n", filepath.Base(path), date, source)
+	if !interactive {
+		return date, nil
+	}
+	return promptDate("Enter — принять, или введите другую дату (DD-MM-YYYY): ", date)
+}
+
+func promptDate(prompt, def string) (string, error) {
+	for {
+		fmt.Fprint(os.Stderr, prompt)
+		line, err := stdinReader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if def != "" {
+				return def, nil
+			}
+			if err != nil {
+				return "", fmt.Errorf("дата не введена")
+			}
+			continue
+		}
+		t, _, perr := ParseDate(line)
+		if perr == nil {
+			return FormatDate(t), nil
+		}
+		fmt.Fprintf(os.Stderr, "Неверный формат даты: %v\n", perr)
+		if err != nil {
+			return "", perr
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ======== Дубликаты ========
+
+// Повторно добавленный файл ловится по SHA-256 исходника (Document.Checksum)
+// и без --allow-duplicate не добавляется. Та же бумага, сфотографированная
+// дважды, даёт разные файлы, поэтому для каждой страницы хранится ещё
+// перцептивный хеш (dHash): страницы, хеши которых отличаются не больше чем
+// на nearDuplicateBits бит, считаются похожими, и add о них предупреждает.
+
+// nearDuplicateBits — сколько бит из 64 могут различаться у похожих страниц.
+const nearDuplicateBits = 6
+
+// imageDHash вычисляет dHash изображения: картинка уменьшается до 9×8 в
+// оттенках серого, каждый бит — ярче ли клетка своей соседки справа.
+// Хеш не меняется от масштаба, сжатия и небольших сдвигов яркости.
+func imageDHash(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	img, _, err := image.Decode(bufio.NewReader(f))
+	f.Close()
+	if err != nil {
+		return 0, fmt.Errorf("не удалось декодировать %s: %w", path, err)
+	}
+	const w, h = 9, 8
+	var sum, count [h][w]float64
+	b := img.Bounds()
+	dx, dy := b.Dx(), b.Dy()
+	if dx == 0 || dy == 0 {
+		return 0, fmt.Errorf("пустое изображение %s", path)
+	}
+	for y := 0; y < dy; y++ {
+		cy := y * h / dy
+		for x := 0; x < dx; x++ {
+			cx := x * w / dx
+			sum[cy][cx] += luma(img, b.Min.X+x, b.Min.Y+y)
+			count[cy][cx]++
+		}
+	}
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			if sum[y][x]/count[y][x] > sum[y][x+1]/count[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash, nil
+}
+
+// luma — яркость пикселя; для JPEG (YCbCr) и серых изображений берётся
+// напрямую, без преобразования в RGB.
+func luma(img image.Image, x, y int) float64 {
+	switch m := img.(type) {
+	case *image.YCbCr:
+		return float64(m.Y[m.YOffset(x, y)])
+	case *image.Gray:
+		return float64(m.Pix[m.PixOffset(x, y)])
+	}
+	r, g, b, _ := img.At(x, y).RGBA()
+	return (299*float64(r) + 587*float64(g) + 114*float64(b)) / 1000 / 257
+}
+
+func formatDHash(h uint64) string {
+	return fmt.Sprintf("%016x", h)
+}
+
+func parseDHash(s string) (uint64, bool) {
+	h, err := strconv.ParseUint(s, 16, 64)
+	return h, err == nil && s != ""
+}
+
+// pageHash — перцептивный хеш одной страницы архива.
+type pageHash struct {
+	hash uint64
+	doc  docMatch
+}
+
+// duplicateIndex — контрольные суммы исходников и хеши страниц архива
+// текущего пациента (без корзины).
+type duplicateIndex struct {
+	sums   map[string]docMatch
+	hashes []pageHash
+}
+
+func loadDuplicateIndex(fotoBase string) (*duplicateIndex, error) {
+	all, err := selectDocuments(fotoBase, "", time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	idx := &duplicateIndex{sums: make(map[string]docMatch)}
+	for _, m := range all {
+		idx.add(m)
+	}
+	return idx, nil
+}
+
+func (idx *duplicateIndex) add(m docMatch) {
+	if m.Doc.Checksum != "" {
+		if _, ok := idx.sums[m.Doc.Checksum]; !ok {
+			idx.sums[m.Doc.Checksum] = m
+		}
+	}
+	for _, p := range m.Doc.Pages {
+		if h, ok := parseDHash(p.DHash); ok {
+			idx.hashes = append(idx.hashes, pageHash{hash: h, doc: m})
+		}
+	}
+}
+
+// duplicateError — ошибка add для файла, который уже есть в архиве.
+func duplicateError(m docMatch) error {
+	return fmt.Errorf("файл уже добавлен: %s; чтобы добавить его ещё раз, укажите --allow-duplicate", describeDoc(m))
+}
+
+// exact возвращает документ с тем же исходным файлом.
+func (idx *duplicateIndex) exact(checksum string) (docMatch, bool) {
+	m, ok := idx.sums[checksum]
+	return m, ok
+}
+
+// similar возвращает описания документов, на страницы которых похожи
+// страницы pages, — по одному на документ, с номерами совпавших страниц.
+func (idx *duplicateIndex) similar(pages []Page) []string {
+	type hit struct {
+		doc   docMatch
+		pages []string
+	}
+	var hits []*hit
+	byID := make(map[string]*hit)
+	for pi, p := range pages {
+		h, ok := parseDHash(p.DHash)
+		if !ok {
+			continue
+		}
+		for _, e := range idx.hashes {
+			if bits.OnesCount64(h^e.hash) > nearDuplicateBits {
+				continue
+			}
+			x := byID[e.doc.Doc.ID]
+			if x == nil {
+				x = &hit{doc: e.doc}
+				byID[e.doc.Doc.ID] = x
+				hits = append(hits, x)
+			}
+			x.pages = append(x.pages, strconv.Itoa(pi+1))
+			break
+		}
+	}
+	var out []string
+	for _, x := range hits {
+		desc := describeDoc(x.doc)
+		if len(pages) > 1 {
+			desc += ", страницы " + strings.Join(x.pages, ", ")
+		}
+		out = append(out, desc)
+	}
+	return out
+}
+
+// describeDoc — короткое описание документа для сообщений о дубликатах.
+func describeDoc(m docMatch) string {
+	return fmt.Sprintf("%s «%s» от %s (%s)", m.Doc.ID, m.Doc.Title, m.Doc.Date, specDisplayName(m.Spec))
+}
+
+// fillPageHashes дописывает dHash страницам, у которых его нет (документы,
+// добавленные до появления хешей). Возвращает число обработанных страниц.
+func fillPageHashes(dir string) (int, error) {
+	m, _, err := loadManifest(dir)
+	if err != nil {
+		return 0, err
+	}
+	missing := 0
+	for _, d := range m.Documents {
+		for _, p := range d.Pages {
+			if p.DHash == "" {
+				missing++
+			}
+		}
+	}
+	if missing == 0 {
+		return 0, nil
+	}
+	filled := 0
+	err = UpdateManifest(dir, func(m *Manifest) error {
+		for di := range m.Documents {
+			for pi := range m.Documents[di].Pages {
+				p := &m.Documents[di].Pages[pi]
+				if p.DHash != "" {
+					continue
+				}
+				h, err := imageDHash(filepath.Join(dir, p.File))
+				if err != nil {
+					continue // нечитаемая страница — просто без хеша
+				}
+				p.DHash = formatDHash(h)
+				filled++
+			}
+		}
+		return nil
+	})
+	return filled, err
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ======== Edit ========
+
+// docEdit — изменения, которые нужно применить к документу.
+// Пустые поля не меняются.
+type docEdit struct {
+	Spec   string // slug новой специализации
+	Date   string // DD-MM-YYYY
+	Name   string // новый префикс имени файлов
+	Title  string
+	Doctor string
+	Clinic string
+	Notes  string
+
+	AddTags    []string
+	RemoveTags []string
+}
+
+func (e docEdit) empty() bool {
+	return e.Spec == "" && e.Date == "" && e.Name == "" && e.Title == "" && e.Doctor == "" &&
+		e.Clinic == "" && e.Notes == "" && len(e.AddTags) == 0 && len(e.RemoveTags) == 0
+}
+
+func runEdit(args []string) {
+	fs := flag.NewFlagSet("edit", flag.ExitOnError)
+	var (
+		spec    string
+		dateStr string
+		name    string
+		e       docEdit
+	)
+	fs.StringVar(&spec, "s", "", "новая специализация")
+	fs.StringVar(&spec, "spec", "", "новая специализация")
+	fs.StringVar(&dateStr, "d", "", "новая дата DD-MM-YYYY")
+	fs.StringVar(&dateStr, "date", "", "новая дата DD-MM-YYYY")
+	fs.StringVar(&name, "n", "", "новый префикс имени файла (и название, если не указан -t)")
+	fs.StringVar(&name, "name", "", "новый префикс имени файла (и название, если не указан -t)")
+	fs.StringVar(&e.Title, "t", "", "новое название документа")
+	fs.StringVar(&e.Title, "title", "", "новое название документа")
+	fs.StringVar(&e.Doctor, "doctor", "", "врач")
+	fs.StringVar(&e.Clinic, "clinic", "", "клиника")
+	fs.StringVar(&e.Notes, "notes", "", "заметки")
+	listFlag(fs, "tag", "добавить теги через запятую", &e.AddTags)
+	listFlag(fs, "untag", "убрать теги через запятую", &e.RemoveTags)
+	patient := patientFlag(fs)
+	ref := parseWithLeadingArg(fs, args)
+	usePatient(*patient, false)
+
+	if ref == "" {
+		log.Println("Ошибка: укажите ID документа или путь к его JPG.")
+		fs.Usage()
+		os.Exit(1)
+	}
+	// Новая специализация регистрируется только после переноса документа.
+	var newSpec *SpecEntry
+	if spec != "" {
+		s, isNew := findSpec(spec, true, nil)
+		e.Spec = s.Slug
+		if isNew {
+			newSpec = &s
+		}
+	}
+	if dateStr != "" {
+		date, _, err := ParseDate(dateStr)
+		if err != nil {
+			log.Fatalf("Неверный формат даты: %v", err)
+		}
+		e.Date = FormatDate(date)
+	}
+	if name != "" {
+		e.Name = Sanitize(name)
+		if e.Title == "" {
+			e.Title = name
+		}
+	}
+	if e.empty() {
+		log.Println("Ошибка: нечего менять — укажите --spec, --date, --name, --tag или другие поля.")
+		os.Exit(1)
+	}
+
+	m, err := resolveDocRef(baseFotoDir, ref)
+	if err != nil {
+		log.Fatalf("Ошибка: %v", err)
+	}
+	updated, err := EditDocument(baseFotoDir, m, e)
+	if err != nil {
+		if newSpec != nil {
+			_ = os.Remove(filepath.Join(baseFotoDir, newSpec.Slug)) // только если пуст
+		}
+		log.Fatalf("Не удалось изменить документ %s: %v", m.Doc.ID, err)
+	}
+	if newSpec != nil {
+		if err := registerSpec(*newSpec); err != nil {
+			log.Printf("Предупреждение: специализация %s не записана в реестр: %v\n", newSpec.Name, err)
+		}
+	}
+	for _, p := range updated.Doc.Pages {
+		log.Printf("Файл: %s\n", filepath.Join(updated.Dir(baseFotoDir), p.File))
+	}
+
+	affected := map[string]bool{m.Spec: true, updated.Spec: true}
+	if err := os.MkdirAll(filepath.Join(basePDFDir, updated.Spec), 0o755); err != nil {
+		log.Fatalf("Не удалось создать директорию pdf/%s: %v", updated.Spec, err)
+	}
+	regenerateSpecs(affected)
+	log.Println("Готово.")
+}
+
+// EditDocument применяет изменения к документу: при смене специализации,
+// даты или имени все его страницы переименовываются и переносятся вместе,
+// mtime выставляется в дату документа, манифесты обновляются.
+func EditDocument(fotoBase string, m docMatch, e docEdit) (docMatch, error) {
+	out := m
+	out.Doc.Pages = append([]Page(nil), m.Doc.Pages...)
+	if e.Spec != "" {
+		out.Spec = e.Spec
+	}
+	if e.Date != "" {
+		out.Doc.Date = e.Date
+	}
+	if e.Title != "" {
+		out.Doc.Title = e.Title
+	}
+	if e.Doctor != "" {
+		out.Doc.Doctor = e.Doctor
+	}
+	if e.Clinic != "" {
+		out.Doc.Clinic = e.Clinic
+	}
+	if e.Notes != "" {
+		out.Doc.Notes = e.Notes
+	}
+	if len(e.AddTags) > 0 || len(e.RemoveTags) > 0 {
+		out.Doc.Tags = normalizeTags(append(withoutTags(m.Doc.Tags, e.RemoveTags), e.AddTags...))
+	}
+
+	srcDir := m.Dir(fotoBase)
+	dstDir := out.Dir(fotoBase)
+	if e.Spec != "" || e.Date != "" || e.Name != "" {
+		if err := os.MkdirAll(dstDir, 0o755); err != nil {
+			return m, err
+		}
+		names, err := planPageNames(srcDir, dstDir, m.Doc.Pages, out.Doc.Date, e.Name)
+		if err != nil {
+			return m, err
+		}
+		if err := movePages(srcDir, dstDir, m.Doc.Pages, names); err != nil {
+			return m, err
+		}
+		date := out.Doc.Time()
+		for i := range out.Doc.Pages {
+			out.Doc.Pages[i].File = names[i]
+			_ = os.Chtimes(filepath.Join(dstDir, names[i]), time.Now(), date)
+		}
+	}
+
+	if srcDir != dstDir {
+		err := UpdateManifest(srcDir, func(man *Manifest) error {
+			man.Documents = removeDocument(man.Documents, m.Doc.ID)
+			return nil
+		})
+		if err != nil {
+			return out, err
+		}
+	}
+	err := UpdateManifest(dstDir, func(man *Manifest) error {
+		for i := range man.Documents {
+			if man.Documents[i].ID == out.Doc.ID {
+				man.Documents[i] = out.Doc
+				return nil
+			}
+		}
+		man.Documents = append(man.Documents, out.Doc)
+		return nil
+	})
+	return out, err
+}
+
+// planPageNames подбирает новые имена страниц по схеме
+// <name>_DD_MM_YYYY.jpg или <name>_DD_MM_YYYY_page_NNN.jpg. Если хоть одно
+// имя занято чужим файлом, ко всему документу добавляется суффикс _NN,
+// чтобы страницы остались одной группой.
+func planPageNames(srcDir, dstDir string, pages []Page, date, nameSlug string) ([]string, error) {
+	_, formatted, err := ParseDate(date)
+	if err != nil {
+		return nil, fmt.Errorf("неверная дата документа %q", date)
+	}
+	if nameSlug == "" {
+		nameSlug = namePrefixFromFile(pages[0].File)
+	}
+	if nameSlug == "" {
+		nameSlug = "doc"
+	}
+	own := make(map[string]bool)
+	if srcDir == dstDir {
+		for _, p := range pages {
+			own[p.File] = true
+		}
+	}
+	multi := len(pages) > 1
+	for i := 1; i < 1000; i++ {
+		base := fmt.Sprintf("%s_%s", nameSlug, formatted)
+		if i > 1 {
+			base = fmt.Sprintf("%s_%02d", base, i)
+		}
+		names := make([]string, len(pages))
+		free := true
+		for pi, p := range pages {
+			if multi {
+				names[pi] = fmt.Sprintf("%s_page_%s.jpg", base, pageNumber(p.File, pi))
+			} else {
+				names[pi] = base + ".jpg"
+			}
+			if own[names[pi]] {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(dstDir, names[pi])); !errors.Is(err, os.ErrNotExist) {
+				free = false
+				break
+			}
+		}
+		if free {
+			return names, nil
+		}
+	}
+	return nil, fmt.Errorf("слишком много конфликтов имён в %s", dstDir)
+}
+
+// movePages переносит страницы в два шага через временные имена, чтобы
+// перестановка имён внутри одного каталога ничего не затёрла. При ошибке
+// уже перенесённые файлы возвращаются на место.
+func movePages(srcDir, dstDir string, pages []Page, names []string) error {
+	type move struct{ from, to string }
+	var done []move
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			_ = os.Rename(done[i].to, done[i].from)
+		}
+	}
+	tmp := make([]string, len(pages))
+	for i, p := range pages {
+		tmp[i] = filepath.Join(dstDir, fmt.Sprintf(".edit-%d-%03d.tmp", os.Getpid(), i))
+		from := filepath.Join(srcDir, p.File)
+		if err := os.Rename(from, tmp[i]); err != nil {
+			rollback()
+			return err
+		}
+		done = append(done, move{from, tmp[i]})
+	}
+	for i := range pages {
+		to := filepath.Join(dstDir, names[i])
+		if err := os.Rename(tmp[i], to); err != nil {
+			rollback()
+			return err
+		}
+		done[i].to = to
+	}
+	return nil
+}
+
+// pageNumber сохраняет номер страницы из исходного имени, если он есть.
+func pageNumber(name string, index int) string {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	if mm := pageSuffixPattern.FindStringSubmatch(base); mm != nil {
+		return mm[2]
+	}
+	return fmt.Sprintf("%03d", index)
+}
+
+// parseWithLeadingArg разбирает флаги команды с одним позиционным
+// аргументом, который может стоять перед флагами, после них или между ними
+// («edit <id> --date ...», «edit --title X <id> --date ...»). Лишние
+// позиционные аргументы — ошибка использования.
+func parseWithLeadingArg(fs *flag.FlagSet, args []string) string {
+	pos := parseInterspersed(fs, args)
+	if len(pos) > 1 {
+		fmt.Fprintf(fs.Output(), "Лишние аргументы: %s\n", strings.Join(pos[1:], " "))
+		fs.Usage()
+		os.Exit(2)
+	}
+	if len(pos) == 0 {
+		return ""
+	}
+	return pos[0]
+}
+
+// parseInterspersed разбирает флаги вперемешку с позиционными аргументами:
+// flag.Parse останавливается на первом позиционном, поэтому разбор
+// продолжается с аргумента после него. Возвращает позиционные аргументы
+// по порядку.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			os.Exit(2) // при ExitOnError сюда не попадаем
+		}
+		if fs.NArg() == 0 {
+			return pos
+		}
+		pos = append(pos, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
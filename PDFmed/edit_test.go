@@ -0,0 +1,202 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func pagesOf(files ...string) []Page {
+	pages := make([]Page, len(files))
+	for i, f := range files {
+		pages[i] = Page{File: f}
+	}
+	return pages
+}
+
+func TestPlanPageNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string // файлы каталога назначения
+		src      string   // "" — тот же каталог
+		pages    []string
+		date     string
+		slug     string
+		want     []string
+	}{
+		{
+			name:     "свои страницы не конфликтуют",
+			existing: []string{"Эндо_01_02_2023_page_000.jpg", "Эндо_01_02_2023_page_001.jpg"},
+			pages:    []string{"Эндо_01_02_2023_page_000.jpg", "Эндо_01_02_2023_page_001.jpg"},
+			date:     "01-02-2023",
+			slug:     "Эндо",
+			want:     []string{"Эндо_01_02_2023_page_000.jpg", "Эндо_01_02_2023_page_001.jpg"},
+		},
+		{
+			name:     "смена даты на занятое имя",
+			existing: []string{"Эндо_01_02_2023.jpg", "Эндо_05_05_2023.jpg"},
+			pages:    []string{"Эндо_05_05_2023.jpg"},
+			date:     "01-02-2023",
+			slug:     "Эндо",
+			want:     []string{"Эндо_01_02_2023_02.jpg"},
+		},
+		{
+			name:     "занята одна страница из нескольких",
+			existing: []string{"А_01_02_2023_page_001.jpg", "Б_01_02_2023_page_000.jpg", "Б_01_02_2023_page_001.jpg"},
+			pages:    []string{"Б_01_02_2023_page_000.jpg", "Б_01_02_2023_page_001.jpg"},
+			date:     "01-02-2023",
+			slug:     "А",
+			want:     []string{"А_01_02_2023_02_page_000.jpg", "А_01_02_2023_02_page_001.jpg"},
+		},
+		{
+			name:     "перенос в каталог с теми же именами",
+			existing: []string{"Эндо_01_02_2023.jpg", "Эндо_01_02_2023_02.jpg"},
+			src:      "other",
+			pages:    []string{"Эндо_01_02_2023.jpg"},
+			date:     "01-02-2023",
+			slug:     "Эндо",
+			want:     []string{"Эндо_01_02_2023_03.jpg"},
+		},
+		{
+			name:  "нумерация страниц без суффикса",
+			pages: []string{"scan.jpg", "scan2.jpg", "scan3.jpg"},
+			date:  "07-07-2021",
+			slug:  "УЗИ",
+			want:  []string{"УЗИ_07_07_2021_page_000.jpg", "УЗИ_07_07_2021_page_001.jpg", "УЗИ_07_07_2021_page_002.jpg"},
+		},
+		{
+			name:  "номера страниц сохраняются",
+			pages: []string{"x_01_01_2020_page_003.jpg", "x_01_01_2020_page_010.jpg"},
+			date:  "07-07-2021",
+			slug:  "УЗИ",
+			want:  []string{"УЗИ_07_07_2021_page_003.jpg", "УЗИ_07_07_2021_page_010.jpg"},
+		},
+		{
+			name:  "префикс из имени файла",
+			pages: []string{"Кардио_01_01_2020.jpg"},
+			date:  "07-07-2021",
+			want:  []string{"Кардио_07_07_2021.jpg"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := t.TempDir()
+			for _, f := range tt.existing {
+				writeFiles(t, dst, map[string]string{f: f})
+			}
+			src := dst
+			if tt.src != "" {
+				src = filepath.Join(t.TempDir(), tt.src)
+			}
+			got, err := planPageNames(src, dst, pagesOf(tt.pages...), tt.date, tt.slug)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("planPageNames = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func readContent(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestMovePages(t *testing.T) {
+	t.Run("обмен именами внутри каталога", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{"p_000.jpg": "первая", "p_001.jpg": "вторая"})
+		pages := pagesOf("p_000.jpg", "p_001.jpg")
+		if err := movePages(dir, dir, pages, []string{"p_001.jpg", "p_000.jpg"}); err != nil {
+			t.Fatal(err)
+		}
+		if got := readContent(t, filepath.Join(dir, "p_001.jpg")); got != "первая" {
+			t.Errorf("p_001.jpg = %q", got)
+		}
+		if got := readContent(t, filepath.Join(dir, "p_000.jpg")); got != "вторая" {
+			t.Errorf("p_000.jpg = %q", got)
+		}
+		assertOnly(t, dir, "p_000.jpg", "p_001.jpg")
+	})
+	t.Run("перенос в другой каталог", func(t *testing.T) {
+		src, dst := t.TempDir(), t.TempDir()
+		writeFiles(t, src, map[string]string{"a.jpg": "a", "b.jpg": "b", "other.jpg": "x"})
+		if err := movePages(src, dst, pagesOf("a.jpg", "b.jpg"), []string{"n_000.jpg", "n_001.jpg"}); err != nil {
+			t.Fatal(err)
+		}
+		assertOnly(t, src, "other.jpg")
+		assertOnly(t, dst, "n_000.jpg", "n_001.jpg")
+		if got := readContent(t, filepath.Join(dst, "n_001.jpg")); got != "b" {
+			t.Errorf("n_001.jpg = %q", got)
+		}
+	})
+	t.Run("ошибка откатывает переименования", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{"a.jpg": "a", "b.jpg": "b"})
+		// Каталог с непустым содержимым на месте второго имени: rename
+		// файла поверх него не удаётся.
+		if err := os.MkdirAll(filepath.Join(dir, "busy.jpg", "x"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		err := movePages(dir, dir, pagesOf("a.jpg", "b.jpg"), []string{"new.jpg", "busy.jpg"})
+		if err == nil {
+			t.Fatal("ожидалась ошибка")
+		}
+		assertOnly(t, dir, "a.jpg", "b.jpg", "busy.jpg")
+		if got := readContent(t, filepath.Join(dir, "a.jpg")); got != "a" {
+			t.Errorf("a.jpg = %q", got)
+		}
+	})
+}
+
+// assertOnly проверяет, что в dir лежат ровно эти файлы.
+func assertOnly(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	want := append([]string(nil), names...)
+	sort.Strings(want)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("%s: файлы %q, want %q", dir, got, want)
+	}
+}
+
+func TestParseWithLeadingArg(t *testing.T) {
+	tests := []struct {
+		args       []string
+		ref, title string
+		date       string
+	}{
+		{[]string{"abc", "--date", "07-07-2021"}, "abc", "", "07-07-2021"},
+		{[]string{"--title", "X", "abc", "--date", "07-07-2021"}, "abc", "X", "07-07-2021"},
+		{[]string{"--date=07-07-2021", "--title", "X", "abc"}, "abc", "X", "07-07-2021"},
+		{[]string{"--title", "X"}, "", "X", ""},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("edit", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		var title, date string
+		fs.StringVar(&title, "title", "", "")
+		fs.StringVar(&date, "date", "", "")
+		ref := parseWithLeadingArg(fs, tt.args)
+		if ref != tt.ref || title != tt.title || date != tt.date {
+			t.Errorf("%q: ref=%q title=%q date=%q", tt.args, ref, title, date)
+		}
+	}
+}
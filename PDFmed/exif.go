@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// ======== EXIF ========
+
+// Минимальный разбор EXIF (TIFF-структура) без внешних зависимостей.
+// Поддерживаются JPEG (APP1), TIFF, WebP (чанк EXIF) и PNG (чанк eXIf).
+
+const (
+	exifTagOrientation       = 0x0112
+	exifTagDateTime          = 0x0132
+	exifTagExifIFD           = 0x8769
+	exifTagDateTimeOriginal  = 0x9003
+	exifTagDateTimeDigitized = 0x9004
+)
+
+// exifData — значения тегов IFD0 и Exif IFD, приведённые к uint32 или строке.
+type exifData struct {
+	ints    map[uint16]uint32
+	strings map[uint16]string
+}
+
+var errNoEXIF = errors.New("EXIF не найден")
+
+// maxEXIFScan ограничивает чтение TIFF и HEIC, где EXIF может лежать в конце
+// файла: фотографии такого размера не бывают, а видео с расширением
+// изображения не будет прочитано целиком.
+const maxEXIFScan = 64 << 20
+
+// Orientation возвращает значение тега Orientation (1–8), по умолчанию 1.
+func (e *exifData) Orientation() int {
+	if e == nil {
+		return 1
+	}
+	if v, ok := e.ints[exifTagOrientation]; ok && v >= 1 && v <= 8 {
+		return int(v)
+	}
+	return 1
+}
+
+// DateTaken возвращает дату съёмки и имя тега, из которого она взята.
+func (e *exifData) DateTaken() (time.Time, string, bool) {
+	if e == nil {
+		return time.Time{}, "", false
+	}
+	tags := []struct {
+		tag  uint16
+		name string
+	}{
+		{exifTagDateTimeOriginal, "DateTimeOriginal"},
+		{exifTagDateTimeDigitized, "DateTimeDigitized"},
+		{exifTagDateTime, "DateTime"},
+	}
+	for _, t := range tags {
+		v, ok := e.strings[t.tag]
+		if !ok || len(v) < 10 {
+			continue
+		}
+		d, err := time.Parse("2006:01:02", v[:10])
+		if err != nil || d.Year() < 1900 {
+			continue
+		}
+		return d, t.name, true
+	}
+	return time.Time{}, "", false
+}
+
+// readEXIF извлекает EXIF из файла изображения.
+func readEXIF(path string) (*exifData, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	// EXIF всегда в начале файла; 1 МБ хватает с запасом даже для JPEG
+	// с большими превью.
+	data, err := io.ReadAll(io.LimitReader(f, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*")) || isISOBMFF(data) {
+		// В TIFF IFD, а в HEIC блок Exif могут находиться в конце файла.
+		rest, err := io.ReadAll(io.LimitReader(f, maxEXIFScan-int64(len(data))))
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, rest...)
+	}
+	return parseEXIF(data)
+}
+
+// parseEXIF находит блок EXIF в содержимом файла и разбирает его.
+func parseEXIF(data []byte) (*exifData, error) {
+	raw, err := findEXIFBlock(data)
+	if err != nil {
+		return nil, err
+	}
+	return parseTIFF(raw)
+}
+
+func findEXIFBlock(data []byte) ([]byte, error) {
+	switch {
+	case len(data) > 4 && data[0] == 0xFF && data[1] == 0xD8:
+		return jpegEXIF(data)
+	case bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*")):
+		return data, nil
+	case len(data) > 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return riffEXIF(data[12:])
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return pngEXIF(data[8:])
+	case isISOBMFF(data):
+		return scanEXIF(data)
+	}
+	return nil, errNoEXIF
+}
+
+// isISOBMFF распознаёт контейнеры HEIC/HEIF/AVIF по боксу ftyp.
+func isISOBMFF(data []byte) bool {
+	return len(data) > 12 && string(data[4:8]) == "ftyp"
+}
+
+// scanEXIF ищет блок «Exif\0\0» с TIFF-заголовком. В HEIC он хранится как
+// отдельный элемент в mdat; полноценный разбор iloc здесь не нужен.
+func scanEXIF(data []byte) ([]byte, error) {
+	for _, hdr := range [][]byte{[]byte("Exif\x00\x00II*\x00"), []byte("Exif\x00\x00MM\x00*")} {
+		if i := bytes.Index(data, hdr); i >= 0 {
+			return data[i+6:], nil
+		}
+	}
+	return nil, errNoEXIF
+}
+
+func jpegEXIF(data []byte) ([]byte, error) {
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return nil, errNoEXIF
+		}
+		marker := data[i+1]
+		if marker == 0xFF { // байт-заполнитель
+			i++
+			continue
+		}
+		if marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			i += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		if size < 2 || i+2+size > len(data) {
+			break
+		}
+		seg := data[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return seg[6:], nil
+		}
+		i += 2 + size
+	}
+	return nil, errNoEXIF
+}
+
+func riffEXIF(data []byte) ([]byte, error) {
+	for len(data) >= 8 {
+		id := string(data[0:4])
+		size := int(binary.LittleEndian.Uint32(data[4:8]))
+		if size < 0 || 8+size > len(data) {
+			break
+		}
+		if id == "EXIF" {
+			chunk := data[8 : 8+size]
+			return bytes.TrimPrefix(chunk, []byte("Exif\x00\x00")), nil
+		}
+		// Чанки выравниваются на чётную границу; у последнего чанка байта
+		// выравнивания может не быть.
+		next := 8 + size + size%2
+		if next > len(data) {
+			break
+		}
+		data = data[next:]
+	}
+	return nil, errNoEXIF
+}
+
+func pngEXIF(data []byte) ([]byte, error) {
+	for len(data) >= 12 {
+		size := int(binary.BigEndian.Uint32(data[0:4]))
+		id := string(data[4:8])
+		if size < 0 || 12+size > len(data) {
+			break
+		}
+		if id == "eXIf" {
+			return data[8 : 8+size], nil
+		}
+		if id == "IDAT" || id == "IEND" {
+			break
+		}
+		data = data[12+size:]
+	}
+	return nil, errNoEXIF
+}
+
+// parseTIFF читает IFD0 и Exif IFD из блока в формате TIFF.
+func parseTIFF(b []byte) (*exifData, error) {
+	if len(b) < 8 {
+		return nil, errNoEXIF
+	}
+	var bo binary.ByteOrder
+	switch string(b[0:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return nil, errNoEXIF
+	}
+	e := &exifData{ints: map[uint16]uint32{}, strings: map[uint16]string{}}
+	readIFD(b, bo, bo.Uint32(b[4:8]), e)
+	if off, ok := e.ints[exifTagExifIFD]; ok {
+		readIFD(b, bo, off, e)
+	}
+	return e, nil
+}
+
+func readIFD(b []byte, bo binary.ByteOrder, off uint32, e *exifData) {
+	if uint64(off)+2 > uint64(len(b)) {
+		return
+	}
+	n := int(bo.Uint16(b[off:]))
+	for i := 0; i < n; i++ {
+		p := int(off) + 2 + i*12
+		if p+12 > len(b) {
+			return
+		}
+		tag := bo.Uint16(b[p:])
+		typ := bo.Uint16(b[p+2:])
+		count := bo.Uint32(b[p+4:])
+		val := b[p+8 : p+12]
+		switch typ {
+		case 3: // SHORT
+			e.ints[tag] = uint32(bo.Uint16(val))
+		case 4: // LONG
+			e.ints[tag] = bo.Uint32(val)
+		case 2: // ASCII
+			s := val
+			if count > 4 {
+				o := bo.Uint32(val)
+				if uint64(o)+uint64(count) > uint64(len(b)) {
+					continue
+				}
+				s = b[o : o+count]
+			} else {
+				s = val[:count]
+			}
+			e.strings[tag] = string(bytes.TrimRight(s, "\x00 "))
+		}
+	}
+}
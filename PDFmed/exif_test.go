@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// testTIFF собирает TIFF (little endian) с IFD0 из Orientation и DateTime.
+func testTIFF(orientation uint16, date string) []byte {
+	b := []byte("II*\x00")
+	b = binary.LittleEndian.AppendUint32(b, 8)
+	b = binary.LittleEndian.AppendUint16(b, 2)
+	// Orientation, SHORT, 1 значение.
+	b = binary.LittleEndian.AppendUint16(b, exifTagOrientation)
+	b = binary.LittleEndian.AppendUint16(b, 3)
+	b = binary.LittleEndian.AppendUint32(b, 1)
+	b = binary.LittleEndian.AppendUint16(b, orientation)
+	b = append(b, 0, 0)
+	// DateTime, ASCII, строка сразу после IFD.
+	str := append([]byte(date), 0)
+	b = binary.LittleEndian.AppendUint16(b, exifTagDateTime)
+	b = binary.LittleEndian.AppendUint16(b, 2)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(str)))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(b)+4+4))
+	b = binary.LittleEndian.AppendUint32(b, 0) // следующего IFD нет
+	return append(b, str...)
+}
+
+func testJPEG(tiff []byte) []byte {
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	b := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(seg)+2))
+	b = append(b, seg...)
+	return append(b, 0xFF, 0xD9)
+}
+
+func testRIFF(chunks ...[]byte) []byte {
+	var body []byte
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	b := []byte("RIFF")
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(body)+4))
+	b = append(b, "WEBP"...)
+	return append(b, body...)
+}
+
+func testChunk(id string, data []byte, pad bool) []byte {
+	b := []byte(id)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	b = append(b, data...)
+	if pad && len(data)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func testPNG(tiff []byte) []byte {
+	b := []byte("\x89PNG\r\n\x1a\n")
+	b = binary.BigEndian.AppendUint32(b, uint32(len(tiff)))
+	b = append(b, "eXIf"...)
+	b = append(b, tiff...)
+	return append(b, 0, 0, 0, 0) // CRC не проверяется
+}
+
+func testHEIC(tiff []byte) []byte {
+	b := []byte{0, 0, 0, 16}
+	b = append(b, "ftypheic\x00\x00\x00\x00"...)
+	b = append(b, "\x00\x00\x00\x00mdat"...)
+	b = append(b, "Exif\x00\x00"...)
+	return append(b, tiff...)
+}
+
+func TestParseEXIF(t *testing.T) {
+	tiff := testTIFF(6, "2023:02:01 10:00:00")
+	want := time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"tiff", tiff, true},
+		{"jpeg", testJPEG(tiff), true},
+		{"png", testPNG(tiff), true},
+		{"heic", testHEIC(tiff), true},
+		{"webp", testRIFF(testChunk("VP8 ", []byte{1, 2, 3}, true), testChunk("EXIF", tiff, true)), true},
+		{"webp без EXIF", testRIFF(testChunk("VP8 ", []byte{1, 2, 3}, true)), false},
+		{"webp без байта выравнивания", testRIFF(testChunk("VP8 ", []byte{1, 2, 3}, false)), false},
+		{"webp с обрезанным чанком", testRIFF(testChunk("VP8 ", []byte{1, 2, 3}, true)[:9]), false},
+		{"jpeg обрезанный", testJPEG(tiff)[:20], false},
+		{"tiff с IFD за концом", []byte("II*\x00\xff\xff\xff\xff"), true},
+		{"пусто", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := parseEXIF(tt.data)
+			if !tt.ok {
+				if err == nil {
+					t.Fatalf("ожидалась ошибка, получено %+v", e)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseEXIF: %v", err)
+			}
+			if len(tt.data) < 32 {
+				return // только проверка, что разбор не паникует
+			}
+			if got := e.Orientation(); got != 6 {
+				t.Errorf("Orientation = %d, want 6", got)
+			}
+			d, tag, ok := e.DateTaken()
+			if !ok || !d.Equal(want) || tag != "DateTime" {
+				t.Errorf("DateTaken = %v, %q, %v", d, tag, ok)
+			}
+		})
+	}
+}
+
+func FuzzReadEXIF(f *testing.F) {
+	tiff := testTIFF(3, "2020:01:01 00:00:00")
+	f.Add(tiff)
+	f.Add(testJPEG(tiff))
+	f.Add(testPNG(tiff))
+	f.Add(testHEIC(tiff))
+	f.Add(testRIFF(testChunk("EXIF", tiff, true)))
+	f.Add(testRIFF(testChunk("VP8 ", []byte{1}, false)))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		e, err := parseEXIF(data)
+		if err == nil {
+			e.Orientation()
+			e.DateTaken()
+		}
+	})
+}
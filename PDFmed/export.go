@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ======== Export ========
+
+// runExport собирает один PDF из документов нескольких специализаций и/или
+// тегов за период — например, всё нужное к приёму врача.
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	var (
+		specs   []string
+		tags    []string
+		fromStr string
+		toStr   string
+		outPath string
+		title   string
+	)
+	listFlag(fs, "s", "специализации через запятую (можно повторять)", &specs)
+	listFlag(fs, "spec", "специализации через запятую (можно повторять)", &specs)
+	listFlag(fs, "tag", "теги через запятую (можно повторять)", &tags)
+	fs.StringVar(&fromStr, "from", "", "начальная дата DD-MM-YYYY (включительно)")
+	fs.StringVar(&toStr, "to", "", "конечная дата DD-MM-YYYY (включительно)")
+	fs.StringVar(&outPath, "o", "", "куда сохранить PDF (по умолчанию pdf/export_DD_MM_YYYY.pdf)")
+	fs.StringVar(&outPath, "out", "", "куда сохранить PDF (по умолчанию pdf/export_DD_MM_YYYY.pdf)")
+	fs.StringVar(&title, "t", "Выборка документов", "заголовок обложки")
+	fs.StringVar(&title, "title", "Выборка документов", "заголовок обложки")
+	pdfFlags(fs)
+	patient := patientFlag(fs)
+	_ = fs.Parse(args)
+	usePatient(*patient, false)
+
+	from, to, err := parseDateRange(fromStr, toStr)
+	if err != nil {
+		log.Fatalf("Неверный диапазон дат: %v", err)
+	}
+	sel := exportSelection{From: from, To: to, Tags: tags}
+	for _, s := range specs {
+		sel.Specs = append(sel.Specs, resolveSpec(s, false))
+	}
+
+	all, err := selectDocuments(baseFotoDir, "", from, to)
+	if err != nil {
+		log.Fatalf("Ошибка: %v", err)
+	}
+	var matches []docMatch
+	for _, m := range all {
+		if sel.match(m) {
+			matches = append(matches, m)
+		}
+	}
+	if len(matches) == 0 {
+		log.Fatalf("Подходящих документов не найдено.")
+	}
+	items := docItems(baseFotoDir, matches)
+
+	if outPath == "" {
+		outPath = filepath.Join(basePDFDir, "export_"+time.Now().Format("02_01_2006")+".pdf")
+	}
+	if info, err := os.Stat(outPath); err == nil && info.IsDir() {
+		outPath = filepath.Join(outPath, "export_"+time.Now().Format("02_01_2006")+".pdf")
+	}
+	job := pdfJob{
+		Title:    title,
+		Details:  sel.describe(),
+		Attach:   attachOriginals,
+		ShowSpec: true,
+		Export:   true,
+		Out:      outPath,
+	}
+	if err := renderPDF(items, job); err != nil {
+		log.Fatalf("Ошибка генерации PDF: %v", err)
+	}
+	log.Printf("Документов: %d, страниц: %d\n", len(matches), len(items))
+}
+
+// exportSelection — условия выборки. Документ подходит, если он из одной из
+// специализаций или несёт один из тегов; без обоих условий подходят все.
+// Период проверяется отдельно в selectDocuments.
+type exportSelection struct {
+	Specs    []SpecEntry
+	Tags     []string
+	From, To time.Time
+}
+
+func (s exportSelection) match(m docMatch) bool {
+	if len(s.Specs) == 0 && len(s.Tags) == 0 {
+		return true
+	}
+	for _, sp := range s.Specs {
+		if sp.Slug == m.Spec {
+			return true
+		}
+	}
+	for _, t := range s.Tags {
+		if m.Doc.HasTag(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// describe — строки обложки с описанием выборки.
+func (s exportSelection) describe() []string {
+	var lines []string
+	if len(s.Specs) > 0 {
+		names := make([]string, len(s.Specs))
+		for i, sp := range s.Specs {
+			names[i] = sp.Name
+		}
+		lines = append(lines, "Специализации: "+strings.Join(names, ", "))
+	}
+	if len(s.Tags) > 0 {
+		lines = append(lines, "Теги: "+strings.Join(s.Tags, ", "))
+	}
+	switch {
+	case !s.From.IsZero() && !s.To.IsZero():
+		lines = append(lines, fmt.Sprintf("Отбор: с %s по %s", FormatDate(s.From), FormatDate(s.To)))
+	case !s.From.IsZero():
+		lines = append(lines, "Отбор: с "+FormatDate(s.From))
+	case !s.To.IsZero():
+		lines = append(lines, "Отбор: по "+FormatDate(s.To))
+	}
+	return lines
+}
+
+// docItems разворачивает найденные документы в отсортированные по дате
+// страницы, как collectJPGsSorted, но по нескольким специализациям.
+func docItems(fotoBase string, matches []docMatch) []fotoItem {
+	var items []fotoItem
+	for i := range matches {
+		m := &matches[i]
+		dir := m.Dir(fotoBase)
+		date := m.Doc.Time()
+		for pi, p := range m.Doc.Pages {
+			items = append(items, fotoItem{
+				Path: filepath.Join(dir, p.File),
+				Name: p.File,
+				Date: date,
+				Doc:  &m.Doc,
+				Page: pi,
+				Spec: m.Spec,
+			})
+		}
+	}
+	sortFotoItems(items)
+	return items
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ======== Отпечатки PDF ========
+
+// Рядом с каждым PDF в pdf/ хранится отпечаток его входных данных
+// (.<имя>.pdf.fingerprint): список страниц с размерами, mtime и хешами,
+// метаданные документов, профиль пациента и параметры вёрстки. Если
+// отпечаток не изменился, PDF не пересобирается. По нему же list
+// показывает, устарел ли PDF. Выгрузки export собираются всегда и
+// отпечатков не оставляют.
+
+// forceRegen — пересобирать PDF даже при совпадении отпечатка (regen --force).
+var forceRegen bool
+
+// configTOC и configAttach — оглавление и вложения по настройкам (файл
+// конфигурации, переменные окружения) без разовых флагов --toc и --attach.
+// В отпечаток входят они, а не флаги: иначе после regen --toc list
+// показывал бы все PDF устаревшими, а следующий regen без флага молча
+// собрал бы их без оглавления. PDF, собранный с разовым флагом, остаётся
+// таким, пока не изменятся его данные.
+var (
+	configTOC    = pdfTOC
+	configAttach = attachOriginals
+)
+
+// pdfFlags регистрирует разовые флаги --attach и --toc.
+func pdfFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&attachOriginals, "attach", attachOriginals, "встраивать оригиналы в PDF как вложения")
+	fs.BoolVar(&pdfTOC, "toc", pdfTOC, "добавить в начало PDF оглавление со ссылками")
+}
+
+// pdfFlagsOverride сообщает, что --toc или --attach расходятся с
+// настройками: отпечаток такого PDF не меняется, поэтому он собирается
+// принудительно.
+func pdfFlagsOverride() bool {
+	return pdfTOC != configTOC || attachOriginals != configAttach
+}
+
+// fingerprintVersion меняется при изменении вёрстки PDF в коде, чтобы
+// старые отпечатки перестали совпадать.
+const fingerprintVersion = 1
+
+type fingerprintPage struct {
+	Path     string
+	Size     int64
+	ModTime  int64
+	Checksum string
+	Caption  string
+	Spec     string
+	Doc      string // ID, дата, название и теги документа
+	Files    []string
+}
+
+type fingerprintInput struct {
+	Version  int
+	Title    string
+	Details  []string
+	Attach   bool
+	ShowSpec bool
+	Months   bool
+	TOC      bool
+	PageSize string
+	Margin   float64
+	Profile  Profile
+	Specs    map[string]string
+	Pages    []fingerprintPage
+}
+
+// pdfFingerprint вычисляет отпечаток входных данных PDF.
+func pdfFingerprint(items []fotoItem, job pdfJob, profile Profile) (string, error) {
+	in := fingerprintInput{
+		Version:  fingerprintVersion,
+		Title:    job.Title,
+		Details:  job.Details,
+		Attach:   job.AttachConfig,
+		ShowSpec: job.ShowSpec,
+		Months:   job.MonthBookmarks,
+		TOC:      configTOC,
+		PageSize: pageSize,
+		Margin:   pageMargin,
+		Profile:  profile,
+		Specs:    make(map[string]string),
+	}
+	for _, it := range items {
+		p := fingerprintPage{
+			Path:     it.Path,
+			Checksum: it.Doc.Pages[it.Page].Checksum,
+			Caption:  it.Doc.Pages[it.Page].Caption,
+			Spec:     it.Spec,
+			Doc:      strings.Join(append([]string{it.Doc.ID, it.Doc.Date, it.Doc.Title}, it.Doc.Tags...), "\x00"),
+		}
+		if fi, err := os.Stat(it.Path); err == nil {
+			p.Size, p.ModTime = fi.Size(), fi.ModTime().UnixNano()
+		}
+		if job.AttachConfig && it.Page == 0 {
+			for _, f := range documentFiles(it.Doc) {
+				p.Files = append(p.Files, f.Path)
+			}
+		}
+		if job.ShowSpec {
+			if _, ok := in.Specs[it.Spec]; !ok {
+				in.Specs[it.Spec] = specDisplayName(it.Spec)
+			}
+		}
+		in.Pages = append(in.Pages, p)
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func fingerprintPath(out string) string {
+	return filepath.Join(filepath.Dir(out), "."+filepath.Base(out)+".fingerprint")
+}
+
+// pdfUpToDate сообщает, что PDF существует и собран из тех же данных.
+func pdfUpToDate(out, fingerprint string) bool {
+	if forceRegen {
+		return false
+	}
+	if _, err := os.Stat(out); err != nil {
+		return false
+	}
+	data, err := os.ReadFile(fingerprintPath(out))
+	return err == nil && strings.TrimSpace(string(data)) == fingerprint
+}
+
+func writeFingerprint(out, fingerprint string) error {
+	return os.WriteFile(fingerprintPath(out), []byte(fingerprint+"\n"), 0o644)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ======== Отмена и таймауты ========
+
+// convertTimeout — сколько можно конвертировать один файл (--timeout,
+// PDFMED_TIMEOUT или timeout в конфиге), прежде чем внешняя программа будет
+// остановлена; 0 — без ограничения. Защищает от зависшего ghostscript на
+// повреждённом PDF.
+var convertTimeout = envTimeout()
+
+func envTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("PDFMED_TIMEOUT")); err == nil && d >= 0 {
+		return d
+	}
+	return 10 * time.Minute
+}
+
+// interruptContext возвращает контекст, который отменяется по Ctrl-C
+// (SIGINT) или SIGTERM: запущенные конвертации останавливаются, их
+// незаконченные файлы удаляются. Повторный Ctrl-C завершает программу сразу.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+// withConvertTimeout ограничивает конвертацию одного файла convertTimeout.
+func withConvertTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if convertTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, convertTimeout)
+}
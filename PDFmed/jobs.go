@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"runtime"
+	"strconv"
+)
+
+// ======== Параллельная работа ========
+
+// jobs — сколько конвертаций или сборок PDF выполнять одновременно
+// (--jobs, PDFMED_JOBS или jobs = N в конфиге). По умолчанию — GOMAXPROCS.
+var jobs = envJobs()
+
+func envJobs() int {
+	if n, err := strconv.Atoi(os.Getenv("PDFMED_JOBS")); err == nil && n > 0 {
+		return n
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// jobsFlag регистрирует -j/--jobs в наборе флагов команды.
+func jobsFlag(fs *flag.FlagSet) {
+	fs.IntVar(&jobs, "j", jobs, "сколько файлов или PDF обрабатывать одновременно")
+	fs.IntVar(&jobs, "jobs", jobs, "сколько файлов или PDF обрабатывать одновременно")
+}
+
+// runJobs выполняет work(i) для i от 0 до n-1, не больше jobs задач
+// одновременно. done вызывается в текущей горутине строго по порядку
+// индексов, как только готова очередная задача, — поэтому вывод и сбор
+// ошибок в done не зависят от того, какая задача завершилась раньше.
+func runJobs(n int, work func(i int) error, done func(i int, err error)) {
+	workers := jobs
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+	results := make([]chan error, n)
+	for i := range results {
+		results[i] = make(chan error, 1)
+	}
+	next := make(chan int)
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range next {
+				results[i] <- work(i)
+			}
+		}()
+	}
+	go func() {
+		for i := 0; i < n; i++ {
+			next <- i
+		}
+		close(next)
+	}()
+	for i := 0; i < n; i++ {
+		err := <-results[i]
+		if done != nil {
+			done(i, err)
+		}
+	}
+}
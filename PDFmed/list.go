@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ======== List ========
+
+type docListing struct {
+	ID    string   `json:"id"`
+	Spec  string   `json:"spec"`
+	Date  string   `json:"date"`
+	Title string   `json:"title"`
+	Tags  []string `json:"tags,omitempty"`
+	Pages int      `json:"pages"`
+	Size  int64    `json:"size"`
+}
+
+type specListing struct {
+	Patient   string       `json:"patient,omitempty"`
+	Spec      string       `json:"spec"`
+	Documents []docListing `json:"documents"`
+	Pages     int          `json:"pages"`
+	Size      int64        `json:"size"`
+	PDF       string       `json:"pdf"`
+	PDFStatus string       `json:"pdf_status"` // ok, stale, missing
+}
+
+func runList(args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	var (
+		spec    string
+		fromStr string
+		toStr   string
+		asJSON  bool
+		all     bool
+		tag     string
+	)
+	fs.StringVar(&spec, "s", "", "показать только эту специализацию")
+	fs.StringVar(&spec, "spec", "", "показать только эту специализацию")
+	fs.StringVar(&fromStr, "from", "", "начальная дата DD-MM-YYYY (включительно)")
+	fs.StringVar(&toStr, "to", "", "конечная дата DD-MM-YYYY (включительно)")
+	fs.StringVar(&tag, "tag", "", "показать только документы с этим тегом")
+	fs.BoolVar(&asJSON, "json", false, "вывод в формате JSON")
+	fs.BoolVar(&all, "all-patients", false, "показать документы всех пациентов")
+	patient := patientFlag(fs)
+	_ = fs.Parse(args)
+
+	from, to, err := parseDateRange(fromStr, toStr)
+	if err != nil {
+		log.Fatalf("Неверный диапазон дат: %v", err)
+	}
+
+	patients := []string{*patient}
+	if all {
+		patients = allPatients()
+	}
+	var listings []specListing
+	for _, p := range patients {
+		usePatient(p, false)
+		var specs []string
+		if spec != "" {
+			specs = []string{lookupSpecSlug(spec)}
+		} else {
+			specs, err = listSpecSlugs(baseFotoDir)
+			if err != nil {
+				log.Fatalf("Не удалось прочитать foto/: %v", err)
+			}
+		}
+		for _, slug := range specs {
+			l, err := listSpec(slug, baseFotoDir, basePDFDir, from, to, tag)
+			if err != nil {
+				log.Fatalf("Не удалось прочитать %s: %v", slug, err)
+			}
+			l.Patient = currentPatient
+			listings = append(listings, l)
+		}
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if listings == nil {
+			listings = []specListing{}
+		}
+		if err := enc.Encode(listings); err != nil {
+			log.Fatalf("Ошибка вывода JSON: %v", err)
+		}
+		return
+	}
+	if !all {
+		printListings(listings)
+		return
+	}
+	for i, p := range patients {
+		var own []specListing
+		for _, l := range listings {
+			if l.Patient == p {
+				own = append(own, l)
+			}
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("Пациент: %s\n", patientLabel(p))
+		printListings(own)
+	}
+}
+
+func listSpec(slug, fotoBase, pdfBase string, from, to time.Time, tag string) (specListing, error) {
+	dir := filepath.Join(fotoBase, slug)
+	l := specListing{Spec: slug, Documents: []docListing{}}
+	m, _, err := ReadManifest(dir)
+	if err != nil {
+		return l, err
+	}
+	items := manifestItems(dir, m)
+	var cur *docListing
+	var curDoc *Document
+	for _, it := range items {
+		if !inDateRange(it.Date, from, to) || (tag != "" && !it.Doc.HasTag(tag)) {
+			continue
+		}
+		if it.Doc != curDoc {
+			l.Documents = append(l.Documents, docListing{
+				ID:    it.Doc.ID,
+				Spec:  slug,
+				Date:  it.Doc.Date,
+				Title: it.Doc.Title,
+				Tags:  it.Doc.Tags,
+			})
+			cur = &l.Documents[len(l.Documents)-1]
+			curDoc = it.Doc
+		}
+		var size int64
+		if fi, err := os.Stat(it.Path); err == nil {
+			size = fi.Size()
+		}
+		cur.Pages++
+		cur.Size += size
+		l.Pages++
+		l.Size += size
+	}
+	job := specPDFJob(slug, pdfBase, m)
+	l.PDF = job.Out
+	l.PDFStatus = pdfStatus(items, job)
+	return l, nil
+}
+
+// pdfStatus сравнивает отпечаток, сохранённый при сборке PDF, с отпечатком
+// текущих входных данных — так же, как regen решает, пересобирать ли PDF.
+func pdfStatus(items []fotoItem, job pdfJob) string {
+	if _, err := os.Stat(job.Out); err != nil {
+		return "missing"
+	}
+	profile, _ := ReadProfile(profileFile)
+	fingerprint, err := pdfFingerprint(items, job, profile)
+	if err != nil || !pdfUpToDate(job.Out, fingerprint) {
+		return "stale"
+	}
+	return "ok"
+}
+
+func printListings(listings []specListing) {
+	if len(listings) == 0 {
+		fmt.Println("Архив пуст.")
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tСПЕЦИАЛИЗАЦИЯ\tДАТА\tНАЗВАНИЕ\tСТР.\tРАЗМЕР\tТЕГИ")
+	for _, l := range listings {
+		for _, d := range l.Documents {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", d.ID, d.Spec, d.Date, d.Title, d.Pages, formatSize(d.Size), strings.Join(d.Tags, ", "))
+		}
+	}
+	_ = tw.Flush()
+
+	fmt.Println()
+	tw = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "СПЕЦИАЛИЗАЦИЯ\tДОК.\tСТР.\tРАЗМЕР\tPDF")
+	var docs, pages int
+	var size int64
+	for _, l := range listings {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\n", l.Spec, len(l.Documents), l.Pages, formatSize(l.Size), pdfStatusLabel(l.PDFStatus))
+		docs += len(l.Documents)
+		pages += l.Pages
+		size += l.Size
+	}
+	fmt.Fprintf(tw, "Итого\t%d\t%d\t%s\t\n", docs, pages, formatSize(size))
+	_ = tw.Flush()
+}
+
+func pdfStatusLabel(status string) string {
+	switch status {
+	case "missing":
+		return "отсутствует"
+	case "stale":
+		return "устарел (нужен regen)"
+	default:
+		return "актуален"
+	}
+}
+
+// listSpecSlugs возвращает имена каталогов специализаций в foto/ по алфавиту.
+func listSpecSlugs(fotoBase string) ([]string, error) {
+	entries, err := os.ReadDir(fotoBase)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var slugs []string
+	for _, e := range entries {
+		if e.IsDir() {
+			slugs = append(slugs, e.Name())
+		}
+	}
+	sort.Strings(slugs)
+	return slugs, nil
+}
+
+// parseDateRange разбирает необязательные границы --from/--to.
+func parseDateRange(fromStr, toStr string) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+	if fromStr != "" {
+		if from, _, err = ParseDate(fromStr); err != nil {
+			return from, to, fmt.Errorf("--from: %w", err)
+		}
+	}
+	if toStr != "" {
+		if to, _, err = ParseDate(toStr); err != nil {
+			return from, to, fmt.Errorf("--to: %w", err)
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return from, to, fmt.Errorf("--to раньше --from")
+	}
+	return from, to, nil
+}
+
+func inDateRange(t, from, to time.Time) bool {
+	if !from.IsZero() && t.Before(from) {
+		return false
+	}
+	if !to.IsZero() && t.After(to) {
+		return false
+	}
+	return true
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d Б", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %s", float64(n)/float64(div), []string{"КБ", "МБ", "ГБ", "ТБ"}[exp])
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ======== Блокировка архива ========
+
+// Два одновременных запуска pdfmed (например, скрипт-наблюдатель и человек)
+// могли бы выбрать одно и то же свободное имя страницы или писать один PDF.
+// Поэтому команды берут рекомендательную блокировку файла .pdfmed.lock в
+// корне архива: изменяющие — исключительную, читающие — разделяемую.
+
+const lockFileName = ".pdfmed.lock"
+
+// waitLock — ждать освобождения архива вместо ошибки (--wait, PDFMED_WAIT=1
+// или wait в конфиге).
+var waitLock = os.Getenv("PDFMED_WAIT") == "1"
+
+// errArchiveBusy возвращает lockFile, если блокировку нельзя взять сразу.
+var errArchiveBusy = errors.New("архив занят")
+
+// archiveLock держит файл блокировки открытым до выхода из программы.
+var archiveLock *os.File
+
+// readOnlyCommand сообщает, что команда только читает архив.
+func readOnlyCommand(args []string) bool {
+	sub := ""
+	if len(args) > 1 {
+		sub = args[1]
+	}
+	switch args[0] {
+	case "list", "tags":
+		return true
+	case "export", "original":
+		// Без -o export пишет в pdf/, а путь внутри корня — тоже запись
+		// в архив.
+		out, ok := flagValue(args[1:], "o", "out")
+		if !ok {
+			return args[0] == "original"
+		}
+		return !insideArchive(out)
+	case "trash":
+		return sub == "" || sub == "list" || sub == "ls"
+	case "spec":
+		return sub == "" || sub == "list" || sub == "ls"
+	case "profile":
+		_, name := flagValue(args[1:], "name")
+		_, birth := flagValue(args[1:], "birth")
+		return !name && !birth
+	}
+	return false
+}
+
+// flagValue ищет в аргументах команды флаг с одним из имён (-x, --x,
+// -x=v, --x=v) и возвращает его значение. Разбор флагов самой командой
+// ещё не выполнен, поэтому просматриваются все аргументы.
+func flagValue(args []string, names ...string) (string, bool) {
+	for i, a := range args {
+		if a == "--" {
+			break
+		}
+		if !strings.HasPrefix(a, "-") {
+			continue
+		}
+		a = strings.TrimPrefix(strings.TrimPrefix(a, "-"), "-")
+		key, val, hasVal := strings.Cut(a, "=")
+		if !slices.Contains(names, key) {
+			continue
+		}
+		if hasVal {
+			return val, true
+		}
+		if i+1 < len(args) {
+			return args[i+1], true
+		}
+		return "", true
+	}
+	return "", false
+}
+
+// insideArchive сообщает, что путь лежит внутри корня архива.
+func insideArchive(path string) bool {
+	root, err := filepath.Abs(archiveRoot)
+	if err != nil {
+		return true
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return true
+	}
+	rel, err := filepath.Rel(root, abs)
+	return err != nil || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// lockArchive берёт блокировку архива для команды args[0]. Если архив занят
+// другим запуском, завершает программу с ошибкой или, с --wait, ждёт.
+func lockArchive(args []string) {
+	exclusive := !readOnlyCommand(args)
+	if !exclusive {
+		if _, err := os.Stat(archiveRoot); err != nil {
+			return // читать нечего, команда сама сообщит об отсутствии архива
+		}
+	}
+	if err := os.MkdirAll(archiveRoot, 0o755); err != nil {
+		log.Fatalf("Не удалось создать корень архива %s: %v", archiveRoot, err)
+	}
+	path := filepath.Join(archiveRoot, lockFileName)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		log.Fatalf("Не удалось открыть %s: %v", path, err)
+	}
+	err = lockFile(f, exclusive, false)
+	if errors.Is(err, errArchiveBusy) && waitLock {
+		log.Println("Архив занят другим запуском pdfmed, ожидание...")
+		err = lockFile(f, exclusive, true)
+	}
+	if errors.Is(err, errArchiveBusy) {
+		log.Fatalf("Архив занят другим запуском pdfmed. Повторите позже или добавьте --wait: pdfmed --wait %s ...", args[0])
+	}
+	if err != nil {
+		log.Fatalf("Не удалось заблокировать %s: %v", path, err)
+	}
+	archiveLock = f
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// lockFile: вне Unix flock недоступен, и архив не защищён от
+// одновременных запусков — блокировка считается взятой.
+func lockFile(f *os.File, exclusive, wait bool) error {
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useTestRoot переключает корень архива на временный каталог.
+func useTestRoot(t *testing.T) string {
+	t.Helper()
+	old := archiveRoot
+	t.Cleanup(func() { archiveRoot = old })
+	archiveRoot = t.TempDir()
+	return archiveRoot
+}
+
+func TestFlagValue(t *testing.T) {
+	tests := []struct {
+		args  []string
+		names []string
+		val   string
+		ok    bool
+	}{
+		{[]string{"-o", "a.pdf"}, []string{"o", "out"}, "a.pdf", true},
+		{[]string{"--out", "a.pdf"}, []string{"o", "out"}, "a.pdf", true},
+		{[]string{"-o=a.pdf"}, []string{"o", "out"}, "a.pdf", true},
+		{[]string{"--out=a=b.pdf"}, []string{"o", "out"}, "a=b.pdf", true},
+		{[]string{"-P", "мама", "-s", "ЛОР", "-o", "a.pdf"}, []string{"o", "out"}, "a.pdf", true},
+		{[]string{"abc123", "-o", "a.pdf"}, []string{"o", "out"}, "a.pdf", true},
+		{[]string{"-o"}, []string{"o", "out"}, "", true},
+		{[]string{"--", "-o", "a.pdf"}, []string{"o", "out"}, "", false},
+		{[]string{"-s", "ЛОР"}, []string{"o", "out"}, "", false},
+		{[]string{"-outdir", "x"}, []string{"o", "out"}, "", false},
+		{[]string{"--name=Иванов"}, []string{"name"}, "Иванов", true},
+		{nil, []string{"name"}, "", false},
+	}
+	for _, tt := range tests {
+		val, ok := flagValue(tt.args, tt.names...)
+		if val != tt.val || ok != tt.ok {
+			t.Errorf("flagValue(%q, %q) = %q, %v; want %q, %v", tt.args, tt.names, val, ok, tt.val, tt.ok)
+		}
+	}
+}
+
+func TestReadOnlyCommand(t *testing.T) {
+	root := useTestRoot(t)
+	inside := filepath.Join(root, "visit.pdf")
+	outside := filepath.Join(t.TempDir(), "visit.pdf")
+	tests := []struct {
+		args   string
+		shared bool
+	}{
+		{"list", true},
+		{"list -P мама -s ЛОР", true},
+		{"list --help", true},
+		{"tags", true},
+		{"add -p a.jpg -s ЛОР", false},
+		{"regen", false},
+		{"remove abc123", false},
+		{"edit abc123 --title X", false},
+		{"export", false},
+		{"export -o " + outside, true},
+		{"export --out=" + outside, true},
+		{"export -o " + inside, false},
+		{"export -s ЛОР -- -o " + outside, false},
+		{"original abc123", true},
+		{"original abc123 -o " + outside, true},
+		{"original abc123 -o " + root, false},
+		{"trash", true},
+		{"trash list", true},
+		{"trash ls -P мама", true},
+		{"trash empty", false},
+		{"restore abc123", false},
+		{"spec", true},
+		{"spec list", true},
+		{"spec add Окулист", false},
+		{"spec alias ЛОР ухо", false},
+		{"profile", true},
+		{"profile -P мама", true},
+		{"profile --name Иванов", false},
+		{"profile -P мама --birth=01-02-1950", false},
+		{"profile -- --name Иванов", true},
+		{"help", false},
+	}
+	for _, tt := range tests {
+		if got := readOnlyCommand(strings.Fields(tt.args)); got != tt.shared {
+			t.Errorf("readOnlyCommand(%q) = %v, want %v", tt.args, got, tt.shared)
+		}
+	}
+}
+
+// TestLockArgs проверяет, что после общих флагов перед командой
+// readOnlyCommand получает аргументы, начиная с имени команды.
+func TestLockArgs(t *testing.T) {
+	useTestRoot(t)
+	wait := waitLock
+	t.Cleanup(func() { waitLock = wait })
+	t.Setenv("PDFMED_CONFIG", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	other := t.TempDir()
+	tests := []struct {
+		args   []string
+		shared bool
+	}{
+		{[]string{"--root", other, "list"}, true},
+		{[]string{"--root=" + other, "--wait", "tags"}, true},
+		{[]string{"--root", other, "export", "-o", filepath.Join(other, "x.pdf")}, false},
+		{[]string{"--root", other, "export", "-o", filepath.Join(t.TempDir(), "x.pdf")}, true},
+		{[]string{"--root", other, "--", "profile", "-P", "мама"}, true},
+		{[]string{"--wait", "add", "-p", "a.jpg"}, false},
+	}
+	for _, tt := range tests {
+		args, err := parseGlobalFlags(tt.args)
+		if err != nil {
+			t.Fatalf("parseGlobalFlags(%q): %v", tt.args, err)
+		}
+		if got := readOnlyCommand(args); got != tt.shared {
+			t.Errorf("%q: readOnlyCommand(%q) = %v, want %v", tt.args, args, got, tt.shared)
+		}
+	}
+	if _, err := parseGlobalFlags([]string{"-P", "мама", "list"}); err == nil {
+		t.Error("-P перед командой: ожидалась ошибка, пациент задаётся после команды")
+	}
+}
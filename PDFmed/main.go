@@ -2,6 +2,8 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -15,6 +17,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -27,28 +30,72 @@ import (
 	gofpdf "github.com/phpdave11/gofpdf"
 )
 
-const (
-	baseFotoDir = "foto"
-	basePDFDir  = "pdf"
+// Каталоги архива относительно archiveRoot; с --patient они переносятся в
+// каталог пациента (см. usePatient).
+var (
+	archiveRoot      = "."
+	baseFotoDir      = "foto"
+	basePDFDir       = "pdf"
+	baseTrashDir     = ".trash"
+	baseOriginalsDir = "originals"
 )
 
 func main() {
 	log.SetFlags(0)
 
-	if len(os.Args) < 2 {
+	args, err := parseGlobalFlags(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		printUsage()
+		return
+	}
+	if err != nil {
+		log.Fatalf("Ошибка: %v", err)
+	}
+	if len(args) < 1 {
 		printUsage()
 		os.Exit(1)
 	}
+	switch args[0] {
+	case "help", "-h", "--help":
+	case "add":
+		// runAdd блокирует архив сам, после подтверждения дат.
+	default:
+		lockArchive(args)
+	}
 
-	switch os.Args[1] {
+	switch args[0] {
 	case "add":
-		runAdd(os.Args[2:])
+		runAdd(args[1:])
 	case "regen":
-		runRegen(os.Args[2:])
+		runRegen(args[1:])
+	case "list":
+		runList(args[1:])
+	case "remove", "rm":
+		runRemove(args[1:])
+	case "restore":
+		runRestore(args[1:])
+	case "trash":
+		runTrash(args[1:])
+	case "edit", "move", "mv":
+		runEdit(args[1:])
+	case "original":
+		runOriginal(args[1:])
+	case "attach":
+		runAttach(args[1:])
+	case "export":
+		runExport(args[1:])
+	case "tags":
+		runTags(args[1:])
+	case "spec":
+		runSpec(args[1:])
+	case "profile":
+		runProfile(args[1:])
+	case "migrate":
+		runMigrate(args[1:])
 	case "help", "-h", "--help":
 		printUsage()
 	default:
-		log.Printf("Неизвестная команда: %s\n", os.Args[1])
+		log.Printf("Неизвестная команда: %s\n", args[0])
 		printUsage()
 		os.Exit(1)
 	}
@@ -57,109 +104,282 @@ func main() {
 func printUsage() {
 	fmt.Println("PDFmed — консольное приложение для управления фото анализов и генерации PDF по специализациям.")
 	fmt.Println()
-	fmt.Println("Использование:")
-	fmt.Println("  pdfmed add -p <путь_к_фото_или_pdf> -s <специализация> -d <дата: DD-MM-YYYY> [-n <префикс_имени>]")
-	fmt.Println("  pdfmed regen [-s <специализация>]")
+	fmt.Println("Использование: pdfmed [--config <файл>] [--root <каталог>] [--wait] <команда> ...")
+	fmt.Println()
+	fmt.Println("  pdfmed add -p <путь_к_фото_или_pdf> -s <специализация> [-d <дата: DD-MM-YYYY|auto>] [-y] [-n <префикс_имени>]")
+	fmt.Println("             [-p <путь>]... [<путь>...] [-r] [--from-file <список.csv>]")
+	fmt.Println("             [-t <название>] [--doctor <врач>] [--clinic <клиника>] [--notes <заметки>] [--tag <тег,...>]")
+	fmt.Println("             [--allow-duplicate] [--attach-file <файл>]... [--attach] [--toc] [-q <качество_jpeg>] [--converters go,magick,...]")
+	fmt.Println("             [-j <потоков>] [--timeout <время, напр. 10m>]")
+	fmt.Println("             [--frames <N> | --at <MM:SS,...>]   (для видео)")
+	fmt.Println("  pdfmed regen [-s <специализация>] [--attach] [--toc] [--all-patients] [--force] [-j <потоков>]")
+	fmt.Println("  pdfmed list [-s <специализация>] [--from <дата>] [--to <дата>] [--tag <тег>] [--json] [--all-patients]")
+	fmt.Println("  pdfmed remove [--id <id,...>] [-s <специализация>] [-d <дата>] [--dry-run] [<путь_к_jpg>...]")
+	fmt.Println("  pdfmed restore <id>...")
+	fmt.Println("  pdfmed trash [list|empty]")
+	fmt.Println("  pdfmed edit <id|путь_к_jpg> [-s <специализация>] [-d <дата>] [-n <префикс_имени>] [-t <название>]")
+	fmt.Println("                 [--tag <тег,...>] [--untag <тег,...>]")
+	fmt.Println("  pdfmed tags")
+	fmt.Println("  pdfmed export [-s <специализация,...>] [--tag <тег,...>] [--from <дата>] [--to <дата>] [-o <файл.pdf>] [-t <заголовок>]")
+	fmt.Println("  pdfmed original <id|путь_к_jpg> [-o <путь>]")
+	fmt.Println("  pdfmed attach -s <специализация> on|off|default")
+	fmt.Println("  pdfmed spec [list | add <название> [--alias a,b] | alias <специализация> <синоним>... | merge <откуда> <куда>]")
+	fmt.Println("  pdfmed profile [--name <ФИО>] [--birth <дата рождения>]")
+	fmt.Println("  pdfmed migrate")
+	fmt.Println()
+	fmt.Println("  Одновременно архив может изменять только один запуск pdfmed; если он занят, команда завершится")
+	fmt.Println("  с ошибкой, а с --wait (или PDFMED_WAIT=1) — дождётся его освобождения.")
+	fmt.Println()
+	fmt.Println("  Все команды принимают -P/--patient <пациент> (по умолчанию $PDFMED_PATIENT): архив пациента")
+	fmt.Println("  хранится в <пациент>/foto, <пациент>/pdf и т.д.; без него — в foto/, pdf/ текущего каталога.")
 	fmt.Println()
 	fmt.Println("Команды:")
-	fmt.Println("  add    — добавить фото или PDF (конвертация в JPG) и перегенерировать PDF")
-	fmt.Println("  regen  — перегенерировать PDF (для всех или одной специализации)")
+	fmt.Println("  add    — добавить фото, PDF или видео (конвертация в JPG) и перегенерировать PDF")
+	fmt.Println("  regen  — перегенерировать PDF (для всех или одной специализации), общий pdf/all.pdf и PDF по тегам")
+	fmt.Println("  list   — показать документы архива, итоги по специализациям и состояние PDF")
+	fmt.Println("  remove — перенести документы в корзину .trash/ и перегенерировать PDF")
+	fmt.Println("  restore — вернуть документы из корзины")
+	fmt.Println("  trash  — показать или очистить корзину")
+	fmt.Println("  edit   — сменить специализацию, дату или имя документа (все страницы переносятся вместе)")
+	fmt.Println("  tags   — показать теги и PDF по тегам (pdf/по тегам/<тег>.pdf)")
+	fmt.Println("  export — собрать один PDF из документов нескольких специализаций и тегов за период")
+	fmt.Println("  original — показать или выгрузить исходный файл документа из originals/")
+	fmt.Println("  attach — встраивать ли оригиналы документов в PDF специализации как вложения")
+	fmt.Println("  spec   — реестр специализаций: названия, синонимы, объединение каталогов")
+	fmt.Println("  profile — показать или изменить данные пациента для обложки PDF")
+	fmt.Println("  migrate — создать manifest.json для существующих каталогов foto/ по именам файлов и mtime,")
+	fmt.Println("            дописать страницам хеши для поиска похожих документов")
 	fmt.Println()
 	fmt.Println("Примеры:")
 	fmt.Println("  pdfmed add -p /path/to/IMG_001.heic -s \"Эндокринология\" -d 01-01-2024")
 	fmt.Println("  pdfmed add -p /path/to/report.pdf -s \"Гастроэнтерология\" -d 15-02-2024")
+	fmt.Println("  pdfmed add -s \"Эндокринология\" -d 01-03-2024 -r ~/Downloads/visit/")
+	fmt.Println("  pdfmed add --from-file list.csv   # строки: путь,специализация,дата,имя")
+	fmt.Println("  pdfmed add -p /path/to/IMG_20240301_101500.jpg -s \"Эндокринология\"   # дата из EXIF или имени файла")
+	fmt.Println("  pdfmed add -p /path/to/uzi.mp4 -s \"УЗИ\" -d 15-02-2024 --frames 5")
 	fmt.Println("  pdfmed regen")
 	fmt.Println("  pdfmed regen -s \"Эндокринология\"")
+	fmt.Println("  pdfmed list --from 01-01-2024 --json")
+	fmt.Println("  pdfmed edit 1a2b3c4d --date 02-01-2024 --spec \"Гастроэнтерология\"")
+	fmt.Println("  pdfmed add -p scan.jpg -s \"Эндокринология\" -d 01-01-2024 --attach-file results.csv")
+	fmt.Println("  pdfmed remove -s \"Эндокринология\" -d 01-01-2024")
+	fmt.Println("  pdfmed add -p uzi_thyroid.jpg -s \"УЗИ\" -d 10-03-2024 --tag \"Эндокринология,щитовидная железа\"")
+	fmt.Println("  pdfmed export -s \"Эндокринология,Анализы крови\" --tag \"щитовидная железа\" --from 01-01-2023 -o visit.pdf")
+	fmt.Println("  pdfmed spec alias \"Эндокринология\" эндокринолог эндо")
+	fmt.Println("  pdfmed spec merge эндокринолог Эндокринология")
+	fmt.Println("  pdfmed profile --name \"Иванов Иван Иванович\" --birth 02-03-1980")
+	fmt.Println("  pdfmed profile -P anna --name \"Петрова Анна\" && pdfmed add -P anna -p scan.jpg -s \"Педиатрия\" -d 01-02-2024")
 }
 
 func runAdd(args []string) {
 	fs := flag.NewFlagSet("add", flag.ExitOnError)
 	var (
-		srcPath string
-		spec    string
-		dateStr string
-		name    string
+		srcPaths  stringsFlag
+		listFile  string
+		recursive bool
+		spec      string
+		dateStr   string
+		name      string
+		extra     stringsFlag
+		frames    int
+		atStr     string
+		yes       bool
+		o         addOptions
 	)
-	fs.StringVar(&srcPath, "p", "", "путь к фото или PDF")
-	fs.StringVar(&srcPath, "path", "", "путь к фото или PDF")
+	fs.Var(&srcPaths, "p", "путь к фото, PDF, видео или каталогу (можно повторять)")
+	fs.Var(&srcPaths, "path", "путь к фото, PDF, видео или каталогу (можно повторять)")
+	fs.StringVar(&listFile, "from-file", "", "файл со списком: путь в строке или CSV path,spec,date,name")
+	fs.BoolVar(&recursive, "r", false, "обходить каталоги рекурсивно")
+	fs.BoolVar(&recursive, "recursive", false, "обходить каталоги рекурсивно")
 	fs.StringVar(&spec, "s", "", "специализация (напр. Эндокринология)")
 	fs.StringVar(&spec, "spec", "", "специализация (напр. Эндокринология)")
-	fs.StringVar(&dateStr, "d", "", "дата анализа в формате DD-MM-YYYY")
-	fs.StringVar(&dateStr, "date", "", "дата анализа в формате DD-MM-YYYY")
+	fs.StringVar(&dateStr, "d", autoDate, "дата анализа DD-MM-YYYY или auto (из EXIF, метаданных PDF или имени файла)")
+	fs.StringVar(&dateStr, "date", autoDate, "дата анализа DD-MM-YYYY или auto (из EXIF, метаданных PDF или имени файла)")
+	fs.BoolVar(&yes, "y", false, "не спрашивать подтверждение определённой даты")
+	fs.BoolVar(&yes, "yes", false, "не спрашивать подтверждение определённой даты")
 	fs.StringVar(&name, "n", "", "необязательный префикс имени файла (по умолчанию — специализация)")
 	fs.StringVar(&name, "name", "", "необязательный префикс имени файла (по умолчанию — специализация)")
+	fs.StringVar(&o.Title, "t", "", "название документа (по умолчанию — префикс имени)")
+	fs.StringVar(&o.Title, "title", "", "название документа (по умолчанию — префикс имени)")
+	fs.StringVar(&o.Doctor, "doctor", "", "врач")
+	fs.StringVar(&o.Clinic, "clinic", "", "клиника")
+	fs.StringVar(&o.Notes, "notes", "", "заметки")
+	listFlag(fs, "tag", "теги документа через запятую (можно повторять), напр. УЗИ,щитовидная железа", &o.Tags)
+	fs.BoolVar(&o.AllowDuplicate, "allow-duplicate", false, "добавлять файлы, которые уже есть в архиве, и не искать похожие страницы")
+	fs.Var(&extra, "attach-file", "дополнительный файл для вложения в PDF (CSV, DICOM и т.п.), можно повторять")
+	pdfFlags(fs)
+	fs.IntVar(&jpegQuality, "q", jpegQuality, "качество JPEG (1–100)")
+	fs.IntVar(&jpegQuality, "quality", jpegQuality, "качество JPEG (1–100)")
+	fs.DurationVar(&convertTimeout, "timeout", convertTimeout, "предельное время конвертации одного файла, напр. 2m (0 — без ограничения)")
+	fs.IntVar(&frames, "frames", 1, "видео: сколько кадров извлечь равномерно по длительности")
+	fs.StringVar(&atStr, "at", "", "видео: моменты кадров через запятую, напр. 00:03,00:10")
+	fs.Func("converters", "порядок конвертеров через запятую (по умолчанию "+strings.Join(defaultConverterOrder, ",")+")", func(v string) error {
+		converterOrder = splitList(v)
+		return nil
+	})
+	jobsFlag(fs)
+	patient := patientFlag(fs)
 	_ = fs.Parse(args)
-
-	if srcPath == "" || spec == "" || dateStr == "" {
-		log.Println("Ошибка: нужно указать -p, -s и -d.")
-		fs.Usage()
-		os.Exit(1)
+	usePatient(*patient, false)
+	if pdfFlagsOverride() {
+		forceRegen = true
 	}
 
-	date, formatted, err := ParseDate(dateStr)
-	if err != nil {
-		log.Fatalf("Неверный формат даты: %v", err)
+	if jpegQuality < 1 || jpegQuality > 100 {
+		log.Fatalf("Качество JPEG должно быть от 1 до 100, получено %d", jpegQuality)
 	}
-
-	if name == "" {
-		name = spec
+	o.Convert = ConvertOptions{Quality: jpegQuality, Frames: frames}
+	for _, ts := range splitList(atStr) {
+		t, err := parseTimestamp(ts)
+		if err != nil {
+			log.Fatalf("Ошибка --at: %v", err)
+		}
+		o.Convert.At = append(o.Convert.At, t)
 	}
+	o.Attachments = extra
 
-	specSlug := Sanitize(spec)
-	nameSlug := Sanitize(name)
-
-	fotoDir := filepath.Join(baseFotoDir, specSlug)
-	if err := os.MkdirAll(fotoDir, 0o755); err != nil {
-		log.Fatalf("Не удалось создать директорию %s: %v", fotoDir, err)
+	files, err := expandSources(append(srcPaths, fs.Args()...), recursive)
+	if err != nil {
+		log.Fatalf("Ошибка: %v", err)
 	}
-	if err := os.MkdirAll(filepath.Join(basePDFDir, specSlug), 0o755); err != nil {
-		log.Fatalf("Не удалось создать директорию pdf/%s: %v", specSlug, err)
+	var entries []addEntry
+	for _, f := range files {
+		entries = append(entries, addEntry{Path: f})
 	}
-
-	ext := strings.ToLower(filepath.Ext(srcPath))
-	if ext == ".pdf" {
-		log.Println("Обнаружен PDF, выполняется конвертация страниц в JPG...")
-		pages, err := ConvertPDFToJPGs(srcPath, fotoDir, fmt.Sprintf("%s_%s", nameSlug, formatted))
+	if listFile != "" {
+		listed, err := readListFile(listFile)
 		if err != nil {
-			log.Fatalf("Ошибка конвертации PDF: %v", err)
+			log.Fatalf("Не удалось прочитать список: %v", err)
 		}
-		for _, p := range pages {
-			_ = os.Chtimes(p, time.Now(), date)
-			log.Printf("Добавлена страница: %s\n", p)
+		entries = append(entries, listed...)
+	}
+	if len(entries) == 0 {
+		log.Println("Ошибка: нужно указать -p (или пути аргументами, или --from-file) и -s.")
+		fs.Usage()
+		os.Exit(1)
+	}
+	for i := range entries {
+		e := &entries[i]
+		if e.Spec == "" {
+			e.Spec = spec
 		}
-	} else {
-		dstBase := fmt.Sprintf("%s_%s.jpg", nameSlug, formatted)
-		dstPath := filepath.Join(fotoDir, dstBase)
-		dstPath, err = EnsureUniquePath(dstPath)
-		if err != nil {
-			log.Fatalf("Не удалось подготовить путь назначения: %v", err)
+		if e.Date == "" {
+			e.Date = dateStr
 		}
-		if err := ConvertToJPG(srcPath, dstPath); err != nil {
-			log.Fatalf("Не удалось сконвертировать изображение в JPG: %v", err)
+		if e.Name == "" {
+			e.Name = name
+		}
+		if e.Spec == "" {
+			log.Fatalf("Ошибка: для %s не указана специализация (-s или поле в --from-file).", e.Path)
+		}
+		if strings.EqualFold(e.Date, autoDate) {
+			date, err := resolveAutoDate(e.Path, yes)
+			if err != nil {
+				log.Fatalf("Ошибка: %v (укажите -d DD-MM-YYYY)", err)
+			}
+			e.Date = date
+		}
+		if _, _, err := ParseDate(e.Date); err != nil {
+			log.Fatalf("Неверный формат даты для %s: %v", e.Path, err)
 		}
-		_ = os.Chtimes(dstPath, time.Now(), date)
-		log.Printf("Добавлено: %s\n", dstPath)
 	}
 
-	if err := GeneratePDFForSpec(specSlug, baseFotoDir, basePDFDir); err != nil {
-		log.Fatalf("Ошибка генерации PDF: %v", err)
+	// Подтверждение дат ждёт ввода, поэтому архив блокируется только после
+	// него: иначе другие запуски ждали бы, пока человек ответит.
+	lockArchive([]string{"add"})
+	var pending []SpecEntry // новые специализации пакета, см. findSpec
+	for i := range entries {
+		e := &entries[i]
+		// Новая специализация попадёт в реестр только вместе с первым
+		// добавленным в неё документом (commitEntry). До тех пор её
+		// варианты написания в этом же пакете сводятся к ней через pending.
+		s, isNew := findSpec(e.Spec, true, pending)
+		e.Spec, e.Slug, e.NewSpec = s.Name, s.Slug, isNew
+		if isNew && !slices.ContainsFunc(pending, func(p SpecEntry) bool { return p.Slug == s.Slug }) {
+			pending = append(pending, s)
+		}
+	}
+	if len(extra) > 0 && len(entries) > 1 {
+		log.Fatalf("Ошибка: --attach-file можно использовать только при добавлении одного файла.")
+	}
+
+	// Сначала конвертируем всё, PDF пересобираем один раз на специализацию.
+	ctx, stop := interruptContext()
+	defer stop()
+	added, failed := addEntries(ctx, entries, o)
+	if ctx.Err() != nil {
+		// Как и при ошибке PDF — всё или ничего: уже перенесённые документы
+		// убираются, а PDF ещё не пересобирались и остались прежними.
+		rollbackEntries(added)
+		forgetNewSpecs(entries, map[string]bool{})
+		log.Fatalf("Прервано: добавление отменено, архив и PDF остались прежними.")
+	}
+	affected := make(map[string]bool)
+	for _, m := range added {
+		affected[m.Spec] = true
+	}
+	if err := rebuildPDFs(affected); err != nil {
+		// Откатываем добавление: PDF пишутся атомарно, поэтому не
+		// собравшиеся остались прежними, а успевшие собраться
+		// пересобираются по восстановленным манифестам.
+		log.Printf("Ошибка генерации PDF:\n%v\n", err)
+		rollbackEntries(added)
+		forgetNewSpecs(entries, affected)
+		if err := rebuildPDFs(affected); err != nil {
+			log.Printf("Предупреждение: %v\n", err)
+		}
+		log.Fatalf("Добавление отменено: документы убраны из архива, PDF остались прежними.")
+	}
+	if len(affected) > 0 {
+		log.Println("PDF перегенерирован.")
+	}
+	if failed > 0 {
+		forgetNewSpecs(entries, affected)
+		log.Fatalf("Не удалось добавить файлов: %d из %d", failed, len(entries))
 	}
-	log.Println("PDF перегенерирован.")
 }
 
 func runRegen(args []string) {
 	fs := flag.NewFlagSet("regen", flag.ExitOnError)
-	var spec string
+	var (
+		spec string
+		all  bool
+	)
 	fs.StringVar(&spec, "s", "", "специализация для регенерации (если не указано — для всех)")
 	fs.StringVar(&spec, "spec", "", "специализация для регенерации (если не указано — для всех)")
+	pdfFlags(fs)
+	fs.BoolVar(&all, "all-patients", false, "перегенерировать PDF всех пациентов")
+	fs.BoolVar(&forceRegen, "f", false, "пересобрать PDF, даже если входные данные не менялись")
+	fs.BoolVar(&forceRegen, "force", false, "пересобрать PDF, даже если входные данные не менялись")
+	jobsFlag(fs)
+	patient := patientFlag(fs)
 	_ = fs.Parse(args)
+	if pdfFlagsOverride() {
+		forceRegen = true
+	}
+
+	if !all {
+		usePatient(*patient, false)
+		regenPatient(spec)
+		log.Println("Готово.")
+		return
+	}
+	for _, p := range allPatients() {
+		usePatient(p, false)
+		log.Printf("Пациент: %s\n", patientLabel(p))
+		regenPatient(spec)
+	}
+	log.Println("Готово.")
+}
 
+// regenPatient перегенерирует PDF одной или всех специализаций текущего
+// пациента.
+func regenPatient(spec string) {
 	if spec != "" {
-		specSlug := Sanitize(spec)
+		specSlug := resolveSpec(spec, false).Slug
 		if err := GeneratePDFForSpec(specSlug, baseFotoDir, basePDFDir); err != nil {
 			log.Fatalf("Ошибка генерации PDF для %s: %v", specSlug, err)
 		}
-		log.Println("Готово.")
 		return
 	}
 
@@ -175,6 +395,7 @@ func runRegen(args []string) {
 		log.Println("В foto/ нет специализаций. Нечего регенерировать.")
 		return
 	}
+	var slugs []string
 	for _, e := range entries {
 		if !e.IsDir() {
 			continue
@@ -183,9 +404,82 @@ func runRegen(args []string) {
 		if err := os.MkdirAll(filepath.Join(basePDFDir, specSlug), 0o755); err != nil {
 			log.Fatalf("Не удалось создать директорию pdf/%s: %v", specSlug, err)
 		}
-		log.Printf("Генерация PDF для: %s...\n", specSlug)
-		if err := GeneratePDFForSpec(specSlug, baseFotoDir, basePDFDir); err != nil {
-			log.Fatalf("Ошибка генерации PDF для %s: %v", specSlug, err)
+		slugs = append(slugs, specSlug)
+	}
+	if err := generateSpecPDFs(slugs); err != nil {
+		log.Fatalf("Ошибка генерации PDF:\n%v", err)
+	}
+	if err := regenerateCombined(baseFotoDir, basePDFDir); err != nil {
+		log.Fatalf("Ошибка генерации общих PDF: %v", err)
+	}
+}
+
+// regenerateSpecs перегенерирует PDF для затронутых специализаций.
+func regenerateSpecs(specs map[string]bool) {
+	if err := rebuildPDFs(specs); err != nil {
+		log.Fatalf("Ошибка генерации PDF:\n%v", err)
+	}
+}
+
+// rebuildPDFs перегенерирует PDF затронутых специализаций и общие PDF
+// (хронологию и теги).
+func rebuildPDFs(specs map[string]bool) error {
+	slugs := make([]string, 0, len(specs))
+	for slug := range specs {
+		slugs = append(slugs, slug)
+	}
+	sort.Strings(slugs)
+	if err := generateSpecPDFs(slugs); err != nil {
+		return err
+	}
+	if len(slugs) == 0 {
+		return nil
+	}
+	if err := regenerateCombined(baseFotoDir, basePDFDir); err != nil {
+		return fmt.Errorf("общие PDF: %w", err)
+	}
+	return nil
+}
+
+// generateSpecPDFs собирает PDF специализаций параллельно, не больше jobs
+// одновременно. Ошибки собираются по всем специализациям и возвращаются в
+// порядке slugs.
+func generateSpecPDFs(slugs []string) error {
+	var errs []error
+	runJobs(len(slugs), func(i int) error {
+		return GeneratePDFForSpec(slugs[i], baseFotoDir, basePDFDir)
+	}, func(i int, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", slugs[i], err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	patient := patientFlag(fs)
+	_ = fs.Parse(args)
+	usePatient(*patient, false)
+
+	slugs, err := listSpecSlugs(baseFotoDir)
+	if err != nil {
+		log.Fatalf("Не удалось прочитать foto/: %v", err)
+	}
+	for _, slug := range slugs {
+		written, err := MigrateManifest(filepath.Join(baseFotoDir, slug))
+		if err != nil {
+			log.Fatalf("Ошибка миграции %s: %v", slug, err)
+		}
+		if written {
+			log.Printf("Манифест обновлён: %s\n", slug)
+		}
+		hashed, err := fillPageHashes(filepath.Join(baseFotoDir, slug))
+		if err != nil {
+			log.Fatalf("Ошибка подсчёта хешей страниц %s: %v", slug, err)
+		}
+		if hashed > 0 {
+			log.Printf("Хеши для поиска дубликатов: %s, страниц: %d\n", slug, hashed)
 		}
 	}
 	log.Println("Готово.")
@@ -236,108 +530,41 @@ func EnsureUniquePath(path string) (string, error) {
 
 // ======== Конвертация ========
 
-func ConvertPDFToJPGs(srcPDF, dstDir, baseName string) ([]string, error) {
-	if !haveCmd("magick") && !haveCmd("convert") {
-		return nil, fmt.Errorf("не найден ImageMagick (magick/convert)")
-	}
-	if err := os.MkdirAll(dstDir, 0o755); err != nil {
-		return nil, err
-	}
-
-	pattern := filepath.Join(dstDir, baseName+"_page_%03d.jpg")
-	var cmd *exec.Cmd
-	if haveCmd("magick") {
-		cmd = exec.Command("magick", "-density", "300", srcPDF, "-quality", "85",
-			"-auto-orient", "-colorspace", "sRGB", "-strip", pattern)
-	} else {
-		cmd = exec.Command("convert", "-density", "300", srcPDF, "-quality", "85",
-			"-auto-orient", "-colorspace", "sRGB", "-strip", pattern)
-	}
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("ошибка конвертации PDF → JPG: %w", err)
-	}
-
-	files, err := filepath.Glob(filepath.Join(dstDir, baseName+"_page_*.jpg"))
-	if err != nil {
-		return nil, err
-	}
-	sort.Strings(files)
-	if len(files) == 0 {
-		return nil, fmt.Errorf("не удалось найти JPG-страницы после конвертации")
-	}
-	return files, nil
-}
-
-func ConvertToJPG(src, dst string) error {
-	if !haveCmd("magick") && !haveCmd("convert") {
-		return fmt.Errorf("не найден ImageMagick (magick/convert)")
-	}
-
-	var cmd *exec.Cmd
-	if haveCmd("magick") {
-		cmd = exec.Command("magick", src, "-auto-orient", "-strip", "-quality", "85", "-colorspace", "sRGB", dst)
-	} else {
-		cmd = exec.Command("convert", src, "-auto-orient", "-strip", "-quality", "85", "-colorspace", "sRGB", dst)
-	}
-
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("ошибка конвертации %s → JPG: %w", src, err)
-	}
-	return nil
+func haveCmd(name string) bool {
+	_, err := exec.LookPath(toolPath(name))
+	return err == nil
 }
 
-func convertToJPGExternal(src, dst string) error {
-	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
-		return err
-	}
-	ext := strings.ToLower(filepath.Ext(src))
-	if isVideoExt(ext) && haveCmd("ffmpeg") {
-		if err := runCmd("ffmpeg", "-y", "-i", src, "-frames:v", "1", "-q:v", "2", dst); err == nil {
-			return nil
-		}
-	}
-	if haveCmd("magick") {
-		if ext == ".pdf" {
-			if err := runCmd("magick", "-density", "300", src+"[0]", "-auto-orient", "-colorspace", "sRGB", "-quality", "85", "-strip", dst); err == nil {
-				return nil
-			}
-		}
-		if err := runCmd("magick", src, "-auto-orient", "-colorspace", "sRGB", "-quality", "85", "-strip", dst); err == nil {
-			return nil
-		}
-	}
-	if haveCmd("convert") {
-		if ext == ".pdf" {
-			if err := runCmd("convert", "-density", "300", src+"[0]", "-auto-orient", "-colorspace", "sRGB", "-quality", "85", "-strip", dst); err == nil {
-				return nil
-			}
-		}
-		if err := runCmd("convert", src, "-auto-orient", "-colorspace", "sRGB", "-quality", "85", "-strip", dst); err == nil {
-			return nil
-		}
+// runCmd запускает внешнюю команду; при ошибке добавляет к ней хвост stderr,
+// чтобы причина попала в сводную ошибку конвертации. Вывод команды
+// печатается целиком после её завершения, чтобы вывод параллельных
+// конвертаций не перемешивался построчно. При отмене ctx (Ctrl-C или
+// --timeout) команда принудительно завершается.
+func runCmd(ctx context.Context, name string, args ...string) error {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, toolPath(name), args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	killGroupOnCancel(cmd)
+	cmd.WaitDelay = 5 * time.Second // не ждём бесконечно потомков, держащих вывод
+	err := cmd.Run()
+	os.Stdout.Write(stdout.Bytes())
+	os.Stderr.Write(stderr.Bytes())
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s: %w", name, ctx.Err())
 	}
-	if (ext == ".heic" || ext == ".heif" || ext == ".heics") && haveCmd("heif-convert") {
-		if err := runCmd("heif-convert", src, dst); err == nil {
-			return nil
+	if err != nil {
+		if msg := lastLine(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %w: %s", name, err, msg)
 		}
+		return fmt.Errorf("%s: %w", name, err)
 	}
-	return fmt.Errorf("нет доступных внешних конверторов (установите ImageMagick и/или ffmpeg)")
-}
-
-func haveCmd(name string) bool {
-	_, err := exec.LookPath(name)
-	return err == nil
+	return nil
 }
 
-func runCmd(name string, args ...string) error {
-	cmd := exec.Command(name, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
 }
 
 func isVideoExt(ext string) bool {
@@ -355,6 +582,9 @@ type fotoItem struct {
 	Path string
 	Name string
 	Date time.Time
+	Doc  *Document
+	Page int    // номер страницы внутри документа, с нуля
+	Spec string // slug специализации документа
 }
 
 var datePattern = regexp.MustCompile(`(\d{2})_(\d{2})_(\d{4})`)
@@ -375,37 +605,48 @@ func tryExtractDateFromName(name string) (time.Time, bool) {
 	return t, true
 }
 
+// collectJPGsSorted возвращает страницы специализации по возрастанию даты
+// документа; страницы одного документа идут подряд.
 func collectJPGsSorted(dir string) ([]fotoItem, error) {
-	entries, err := ioutil.ReadDir(dir)
+	m, _, err := ReadManifest(dir)
 	if err != nil {
 		return nil, err
 	}
+	return manifestItems(dir, m), nil
+}
+
+// manifestItems разворачивает документы манифеста в отсортированные страницы.
+func manifestItems(dir string, m *Manifest) []fotoItem {
 	var items []fotoItem
-	for _, e := range entries {
-		if e.IsDir() {
-			continue
-		}
-		name := e.Name()
-		ext := strings.ToLower(filepath.Ext(name))
-		if ext != ".jpg" && ext != ".jpeg" {
-			continue
+	for i := range m.Documents {
+		d := &m.Documents[i]
+		date := d.Time()
+		for pi, p := range d.Pages {
+			items = append(items, fotoItem{
+				Path: filepath.Join(dir, p.File),
+				Name: p.File,
+				Date: date,
+				Doc:  d,
+				Page: pi,
+				Spec: filepath.Base(dir),
+			})
 		}
-		p := filepath.Join(dir, name)
-		var ft time.Time
-		if t, ok := tryExtractDateFromName(name); ok {
-			ft = t
-		} else {
-			ft = e.ModTime()
-		}
-		items = append(items, fotoItem{Path: p, Name: name, Date: ft})
 	}
-	sort.Slice(items, func(i, j int) bool {
-		if items[i].Date.Equal(items[j].Date) {
-			return items[i].Name < items[j].Name
+	sortFotoItems(items)
+	return items
+}
+
+func sortFotoItems(items []fotoItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
 		}
-		return items[i].Date.Before(items[j].Date)
+		if a.Doc != b.Doc {
+			return a.Doc.Pages[0].File < b.Doc.Pages[0].File
+		}
+		return a.Page < b.Page
 	})
-	return items, nil
 }
 
 func ImageDims(path string) (int, int, error) {
@@ -422,58 +663,207 @@ func ImageDims(path string) (int, int, error) {
 	return cfg.Width, cfg.Height, nil
 }
 
-// GeneratePDFForSpec — создаёт PDF из JPG по указанной специализации.
+// GeneratePDFForSpec — создаёт PDF из JPG по указанной специализации
+// в порядке, заданном её манифестом.
 func GeneratePDFForSpec(specSlug string, baseFotoDir, basePDFDir string) error {
 	srcDir := filepath.Join(baseFotoDir, specSlug)
 	if _, err := os.Stat(srcDir); errors.Is(err, os.ErrNotExist) {
 		return fmt.Errorf("директория не найдена: %s", srcDir)
 	}
-	items, err := collectJPGsSorted(srcDir)
+	manifest, changed, err := ReadManifest(srcDir)
 	if err != nil {
-		return fmt.Errorf("не удалось собрать изображения: %w", err)
+		return fmt.Errorf("не удалось прочитать манифест: %w", err)
+	}
+	if changed {
+		if err := WriteManifest(srcDir, manifest); err != nil {
+			return fmt.Errorf("не удалось сохранить манифест: %w", err)
+		}
+		log.Printf("Манифест обновлён: %s\n", srcDir)
 	}
+	items := manifestItems(srcDir, manifest)
 	if len(items) == 0 {
 		log.Printf("Предупреждение: в %s нет JPG изображений для генерации PDF\n", srcDir)
 	}
-	pdf := gofpdf.New("P", "mm", "A4", "")
+	return renderPDF(items, specPDFJob(specSlug, basePDFDir, manifest))
+}
+
+// specPDFJob — параметры PDF специализации.
+func specPDFJob(specSlug, basePDFDir string, m *Manifest) pdfJob {
+	return pdfJob{
+		Title:        specDisplayName(specSlug),
+		Attach:       m.attachEnabled(),
+		AttachConfig: m.attachConfigured(),
+		Out:          filepath.Join(basePDFDir, specSlug, specSlug+".pdf"),
+	}
+}
+
+// pdfJob — параметры сборки одного PDF.
+type pdfJob struct {
+	Title   string   // заголовок обложки и свойство Title
+	Details []string // дополнительные строки обложки (описание выборки)
+	Attach  bool     // встраивать оригиналы как вложения
+	// AttachConfig — Attach по настройкам, без разового --attach; входит в
+	// отпечаток вместо Attach.
+	AttachConfig bool
+	ShowSpec     bool // указывать специализацию в колонтитуле
+	// MonthBookmarks добавляет в закладки уровень месяца между годом и
+	// документом.
+	MonthBookmarks bool
+	// Export — разовая выгрузка: PDF собирается всегда, отпечаток не
+	// проверяется и не сохраняется рядом с файлом пользователя.
+	Export bool
+	Out    string
+}
+
+// renderPDF собирает PDF из отсортированных страниц: обложка, оглавление
+// (если включено), по странице на изображение с закладками и колонтитулами.
+func renderPDF(items []fotoItem, job pdfJob) error {
+	profile, err := ReadProfile(profileFile)
+	if err != nil {
+		log.Printf("Предупреждение: профиль пациента не прочитан: %v\n", err)
+	}
+	var fingerprint string
+	if !job.Export {
+		if fingerprint, err = pdfFingerprint(items, job, profile); err != nil {
+			return err
+		}
+		if pdfUpToDate(job.Out, fingerprint) {
+			log.Printf("PDF актуален: %s\n", job.Out)
+			return nil
+		}
+	}
+
+	pdf := gofpdf.New("P", "mm", pageSize, "")
 	pdf.SetCompression(true)
-	pdf.SetTitle(specSlug, false)
-	pageW, pageH := 210.0, 297.0
-	margin := 10.0
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetTitle(job.Title, true)
+	pdf.SetCreator("pdfmed", true)
+	setupFonts(pdf)
+	pageW, pageH := pdf.GetPageSize()
+	margin := pageMargin
 	maxW := pageW - 2*margin
 	maxH := pageH - 2*margin
 
+	// Размеры читаем заранее: номера страниц нужны оглавлению до отрисовки.
+	type placed struct {
+		fotoItem
+		w, h int
+	}
+	var pages []placed
+	var shown []fotoItem
 	for _, it := range items {
 		wpx, hpx, err := ImageDims(it.Path)
 		if err != nil {
 			log.Printf("Пропуск %s: не удалось прочитать размеры: %v\n", it.Name, err)
 			continue
 		}
+		pages = append(pages, placed{it, wpx, hpx})
+		shown = append(shown, it)
+	}
+
+	// Первая страница — обложка, за ней оглавление (если включено).
+	tocPages := 0
+	if pdfTOC && len(shown) > 0 {
+		tocPages = tocPageCount(len(buildTOC(shown, 0)), pageH, margin)
+	}
+	toc := buildTOC(shown, tocPages+2)
+	if profile.Name != "" {
+		pdf.SetAuthor(profile.Name, true)
+	}
+	cover := coverInfo{Patient: profile, Spec: job.Title, Details: job.Details, Documents: len(toc), Pages: len(shown), Generated: time.Now()}
+	if len(shown) > 0 {
+		cover.From, cover.To = shown[0].Doc.Date, shown[len(shown)-1].Doc.Date
+	}
+
+	var cur *fotoItem
+	setupHeaderFooter(pdf, &cur, job.ShowSpec, 1+tocPages+len(pages), pageW, pageH, margin, pageW/2)
+	drawCover(pdf, cover, pageW, pageH, margin)
+	if tocPages > 0 {
+		for i := range toc {
+			toc[i].Link = pdf.AddLink()
+		}
+		drawTOC(pdf, toc, "Содержание: "+cover.Spec, pageW, pageH, margin)
+	}
+
+	marks := outline{months: job.MonthBookmarks}
+	entry := -1
+	for i := range pages {
+		p := &pages[i]
+		it := &p.fotoItem
 		// Масштабируем по ограничивающей стороне внутри полей
-		scaleW := maxW / float64(wpx)
-		scaleH := maxH / float64(hpx)
+		scaleW := maxW / float64(p.w)
+		scaleH := maxH / float64(p.h)
 		scale := scaleW
 		if scaleH < scaleW {
 			scale = scaleH
 		}
-		wmm := float64(wpx) * scale
-		hmm := float64(hpx) * scale
+		wmm := float64(p.w) * scale
+		hmm := float64(p.h) * scale
 		x := (pageW - wmm) / 2.0
 		y := (pageH - hmm) / 2.0
 
+		newDoc := cur == nil || it.Doc != cur.Doc
+		cur = it
 		pdf.AddPage()
+		if newDoc {
+			entry++
+			marks.bookmarkDocument(pdf, it.Doc)
+			if tocPages > 0 {
+				pdf.SetLink(toc[entry].Link, 0, -1)
+			}
+		}
 		opt := gofpdf.ImageOptions{ImageType: "JPG", ReadDpi: true}
 		pdf.ImageOptions(it.Path, x, y, wmm, hmm, false, opt, 0, "")
+		if caption := it.Doc.Pages[it.Page].Caption; caption != "" {
+			pdf.SetFont(pdfFont, "", 9)
+			pdf.SetXY(margin, pageH-margin)
+			pdf.CellFormat(pageW-2*margin, margin, caption, "", 0, "C", false, 0, "")
+		}
+		if job.Attach && it.Page == 0 {
+			annotateAttachments(pdf, it.Doc, baseOriginalsDir, pageW, margin)
+		}
 	}
 
-	outDir := filepath.Join(basePDFDir, specSlug)
-	if err := os.MkdirAll(outDir, 0o755); err != nil {
-		return err
-	}
-	outPath := filepath.Join(outDir, fmt.Sprintf("%s.pdf", specSlug))
-	if err := pdf.OutputFileAndClose(outPath); err != nil {
+	if err := writePDF(pdf, job.Out); err != nil {
 		return fmt.Errorf("не удалось сохранить PDF: %w", err)
 	}
-	log.Printf("PDF создан: %s\n", outPath)
+	if !job.Export {
+		if err := writeFingerprint(job.Out, fingerprint); err != nil {
+			log.Printf("Предупреждение: не удалось сохранить отпечаток %s: %v\n", job.Out, err)
+		}
+	}
+	log.Printf("PDF создан: %s\n", job.Out)
 	return nil
 }
+
+// writePDF сохраняет PDF во временный файл рядом с out и переименовывает
+// его: при сбое посреди записи в pdf/ остаётся прежний PDF, а не обрезанный.
+func writePDF(pdf *gofpdf.Fpdf, out string) error {
+	if err := pdf.Error(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(out), "."+filepath.Base(out)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	err = pdf.Output(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), out)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ======== Manifest ========
+
+const (
+	manifestFileName = "manifest.json"
+	manifestVersion  = 1
+)
+
+// Manifest — описание всех документов одной специализации (foto/<spec>/manifest.json).
+type Manifest struct {
+	Version         int        `json:"version"`
+	Spec            string     `json:"spec"`
+	AttachOriginals *bool      `json:"attach_originals,omitempty"` // nil — глобальная настройка
+	Documents       []Document `json:"documents"`
+}
+
+// Document — один добавленный документ: фото или многостраничный PDF.
+type Document struct {
+	ID           string       `json:"id"`
+	Title        string       `json:"title"`
+	Date         string       `json:"date"` // DD-MM-YYYY
+	SourceName   string       `json:"source_name,omitempty"`
+	SourceFormat string       `json:"source_format,omitempty"`
+	Doctor       string       `json:"doctor,omitempty"`
+	Clinic       string       `json:"clinic,omitempty"`
+	Notes        string       `json:"notes,omitempty"`
+	Tags         []string     `json:"tags,omitempty"`
+	Checksum     string       `json:"checksum,omitempty"` // sha256 исходного файла
+	Original     string       `json:"original,omitempty"` // путь в originals/
+	Attachments  []StoredFile `json:"attachments,omitempty"`
+	Converter    string       `json:"converter,omitempty"` // какой конвертер создал страницы
+	AddedAt      time.Time    `json:"added_at"`
+	Pages        []Page       `json:"pages"`
+}
+
+// Page — одна JPG-страница документа в каталоге специализации.
+type Page struct {
+	File     string `json:"file"`
+	Checksum string `json:"checksum,omitempty"`
+	Caption  string `json:"caption,omitempty"` // например, таймкод кадра видео
+	DHash    string `json:"dhash,omitempty"`   // перцептивный хеш, см. imageDHash
+}
+
+// Time возвращает дату документа.
+func (d *Document) Time() time.Time {
+	t, _, err := ParseDate(d.Date)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// ReadManifest читает manifest.json из каталога специализации и дополняет его
+// JPG-файлами, которых в нём нет (миграция архивов, созданных до манифестов).
+// Второе значение сообщает, отличается ли результат от файла на диске.
+func ReadManifest(dir string) (*Manifest, bool, error) {
+	m, exists, err := loadManifest(dir)
+	if err != nil {
+		return nil, false, err
+	}
+	synced, err := syncManifest(dir, m)
+	if err != nil {
+		return nil, false, err
+	}
+	return m, !exists || synced, nil
+}
+
+// loadManifest читает manifest.json без сверки с файлами каталога.
+func loadManifest(dir string) (*Manifest, bool, error) {
+	m := &Manifest{Version: manifestVersion, Spec: filepath.Base(dir)}
+	data, err := os.ReadFile(filepath.Join(dir, manifestFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return m, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, false, fmt.Errorf("повреждён %s: %w", filepath.Join(dir, manifestFileName), err)
+	}
+	return m, true, nil
+}
+
+// WriteManifest сохраняет манифест в каталог специализации.
+func WriteManifest(dir string, m *Manifest) error {
+	m.Version = manifestVersion
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, manifestFileName+".tmp")
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, manifestFileName))
+}
+
+// UpdateManifest читает манифест, применяет fn и сохраняет результат.
+// Сверка с файлами каталога выполняется после fn, поэтому fn может
+// добавить документы для только что записанных страниц.
+func UpdateManifest(dir string, fn func(m *Manifest) error) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	m, _, err := loadManifest(dir)
+	if err != nil {
+		return err
+	}
+	if err := fn(m); err != nil {
+		return err
+	}
+	if _, err := syncManifest(dir, m); err != nil {
+		return err
+	}
+	return WriteManifest(dir, m)
+}
+
+// MigrateManifest создаёт или дополняет манифест по именам файлов и mtime.
+// Возвращает true, если манифест был записан.
+func MigrateManifest(dir string) (bool, error) {
+	m, changed, err := ReadManifest(dir)
+	if err != nil {
+		return false, err
+	}
+	if !changed {
+		return false, nil
+	}
+	return true, WriteManifest(dir, m)
+}
+
+var pageSuffixPattern = regexp.MustCompile(`^(.*)_page_(\d{3,})$`)
+
+// syncManifest приводит манифест в соответствие с файлами каталога:
+// убирает исчезнувшие страницы и добавляет документы для новых JPG.
+func syncManifest(dir string, m *Manifest) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+	present := make(map[string]os.DirEntry)
+	for _, e := range entries {
+		if e.IsDir() || !isJPGName(e.Name()) {
+			continue
+		}
+		present[e.Name()] = e
+	}
+
+	changed := false
+	known := make(map[string]bool)
+	docs := m.Documents[:0]
+	for _, d := range m.Documents {
+		pages := d.Pages[:0]
+		for _, p := range d.Pages {
+			if _, ok := present[p.File]; !ok {
+				changed = true
+				continue
+			}
+			known[p.File] = true
+			pages = append(pages, p)
+		}
+		d.Pages = pages
+		if len(d.Pages) == 0 {
+			changed = true
+			continue
+		}
+		docs = append(docs, d)
+	}
+	m.Documents = docs
+
+	// Непривязанные файлы группируются в документы: страницы одного PDF
+	// (<base>_page_NNN.jpg) становятся одним документом.
+	groups := make(map[string][]string)
+	var order []string
+	for name := range present {
+		if known[name] {
+			continue
+		}
+		key := strings.TrimSuffix(name, filepath.Ext(name))
+		if mm := pageSuffixPattern.FindStringSubmatch(key); mm != nil {
+			key = mm[1] + "_page"
+		}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], name)
+	}
+	sort.Strings(order)
+	used := make(map[string]bool)
+	for _, d := range m.Documents {
+		used[d.ID] = true
+	}
+	for _, key := range order {
+		files := groups[key]
+		sort.Strings(files)
+		doc, err := migratedDocument(dir, m.Spec, files, present[files[0]], used)
+		if err != nil {
+			return false, err
+		}
+		m.Documents = append(m.Documents, doc)
+		changed = true
+	}
+	return changed, nil
+}
+
+// migratedDocument собирает документ из непривязанных файлов. Манифест
+// при чтении не сохраняется, поэтому ID выводится из содержимого первой
+// страницы: иначе каждый list показывал бы новые ID и remove --id не
+// находил бы документ.
+func migratedDocument(dir, spec string, files []string, first os.DirEntry, used map[string]bool) (Document, error) {
+	info, err := first.Info()
+	if err != nil {
+		return Document{}, err
+	}
+	date := info.ModTime()
+	if t, ok := tryExtractDateFromName(first.Name()); ok {
+		date = t
+	}
+	doc := Document{
+		Title:        titleFromFileName(first.Name(), spec),
+		Date:         FormatDate(date),
+		SourceFormat: "jpg",
+		AddedAt:      time.Now(),
+	}
+	if len(files) > 1 || pageSuffixPattern.MatchString(strings.TrimSuffix(first.Name(), filepath.Ext(first.Name()))) {
+		doc.SourceFormat = "pdf"
+	}
+	for _, name := range files {
+		sum, err := fileSHA256(filepath.Join(dir, name))
+		if err != nil {
+			return Document{}, err
+		}
+		doc.Pages = append(doc.Pages, Page{File: name, Checksum: sum})
+	}
+	if len(doc.Pages) == 1 {
+		doc.Checksum = doc.Pages[0].Checksum
+	}
+	doc.ID = migratedDocID(doc.Pages[0].Checksum, used)
+	used[doc.ID] = true
+	return doc, nil
+}
+
+// migratedDocID возвращает ID из первых символов контрольной суммы; при
+// совпадении (одинаковые страницы в разных документах) добавляется номер.
+func migratedDocID(sum string, used map[string]bool) string {
+	id := sum
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	for n := 2; used[id]; n++ {
+		id = fmt.Sprintf("%.8s-%d", sum, n)
+	}
+	return id
+}
+
+// titleFromFileName восстанавливает название документа из имени вида
+// <name>_DD_MM_YYYY[_NN][_page_NNN].jpg.
+func titleFromFileName(name, fallback string) string {
+	base := strings.ReplaceAll(namePrefixFromFile(name), "_", " ")
+	if base == "" {
+		return fallback
+	}
+	return base
+}
+
+// namePrefixFromFile возвращает префикс имени до даты: для
+// «Эндо_01_02_2023_page_001.jpg» это «Эндо».
+func namePrefixFromFile(name string) string {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	if mm := pageSuffixPattern.FindStringSubmatch(base); mm != nil {
+		base = mm[1]
+	}
+	if locs := datePattern.FindAllStringIndex(base, -1); len(locs) > 0 {
+		base = base[:locs[len(locs)-1][0]]
+	}
+	return strings.Trim(base, "_-")
+}
+
+func isJPGName(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".jpg" || ext == ".jpeg"
+}
+
+// FormatDate возвращает дату в формате DD-MM-YYYY.
+func FormatDate(t time.Time) string {
+	return t.Format("02-01-2006")
+}
+
+func newDocID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%08x", time.Now().UnixNano()&0xffffffff)
+	}
+	return hex.EncodeToString(b)
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeFiles создаёт в dir файлы name → содержимое.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// docFiles описывает документы манифеста как «файл1,файл2» для сравнения.
+func docFiles(m *Manifest) []string {
+	var out []string
+	for _, d := range m.Documents {
+		var names []string
+		for _, p := range d.Pages {
+			names = append(names, p.File)
+		}
+		out = append(out, strings.Join(names, ","))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestReadManifestMigration(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		docs   []string
+		titles []string
+	}{
+		{
+			name:   "отдельные фото",
+			files:  map[string]string{"ЭКГ_01_02_2023.jpg": "a", "Эхо_03_04_2023.jpeg": "b", "notes.txt": "x"},
+			docs:   []string{"ЭКГ_01_02_2023.jpg", "Эхо_03_04_2023.jpeg"},
+			titles: []string{"ЭКГ", "Эхо"},
+		},
+		{
+			name: "страницы PDF — один документ",
+			files: map[string]string{
+				"Анализ_01_02_2023_page_001.jpg": "p2",
+				"Анализ_01_02_2023_page_000.jpg": "p1",
+				"Анализ_01_02_2023_page_002.jpg": "p3",
+			},
+			docs:   []string{"Анализ_01_02_2023_page_000.jpg,Анализ_01_02_2023_page_001.jpg,Анализ_01_02_2023_page_002.jpg"},
+			titles: []string{"Анализ"},
+		},
+		{
+			name: "два PDF с разными префиксами",
+			files: map[string]string{
+				"А_01_02_2023_page_000.jpg": "a1",
+				"А_01_02_2023_page_001.jpg": "a2",
+				"Б_01_02_2023_page_000.jpg": "b1",
+			},
+			docs: []string{"А_01_02_2023_page_000.jpg,А_01_02_2023_page_001.jpg", "Б_01_02_2023_page_000.jpg"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			m, changed, err := ReadManifest(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !changed {
+				t.Error("changed = false для архива без манифеста")
+			}
+			if got := docFiles(m); strings.Join(got, "|") != strings.Join(tt.docs, "|") {
+				t.Errorf("документы = %q, want %q", got, tt.docs)
+			}
+			for i, title := range tt.titles {
+				if m.Documents[i].Title != title {
+					t.Errorf("Title[%d] = %q, want %q", i, m.Documents[i].Title, title)
+				}
+			}
+		})
+	}
+}
+
+func TestMigratedIDsStable(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"А_01_02_2023.jpg":          "a",
+		"Б_01_02_2023_page_000.jpg": "b1",
+		"Б_01_02_2023_page_001.jpg": "b2",
+	})
+	ids := func() []string {
+		m, _, err := ReadManifest(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, d := range m.Documents {
+			out = append(out, d.ID)
+		}
+		return out
+	}
+	first, second := ids(), ids()
+	if strings.Join(first, ",") != strings.Join(second, ",") {
+		t.Fatalf("ID меняются между чтениями: %v и %v", first, second)
+	}
+	sum, err := fileSHA256(filepath.Join(dir, "А_01_02_2023.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first[0] != sum[:8] {
+		t.Errorf("ID = %q, want %q (начало SHA-256 первой страницы)", first[0], sum[:8])
+	}
+}
+
+func TestMigratedIDCollisions(t *testing.T) {
+	dir := t.TempDir()
+	// Одинаковые страницы в разных документах и документ из манифеста с
+	// тем же ID.
+	writeFiles(t, dir, map[string]string{
+		"А_01_02_2023.jpg": "same",
+		"Б_01_02_2023.jpg": "same",
+		"В_01_02_2023.jpg": "same",
+		"Г_01_02_2023.jpg": "other",
+	})
+	sum, err := fileSHA256(filepath.Join(dir, "Г_01_02_2023.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = WriteManifest(dir, &Manifest{Documents: []Document{{
+		ID:    sum[:8],
+		Title: "Г",
+		Pages: []Page{{File: "Г_01_02_2023.jpg"}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Файл Г уже в манифесте, поэтому добавим ещё одну копию с его содержимым.
+	writeFiles(t, dir, map[string]string{"Д_01_02_2023.jpg": "other"})
+
+	m, _, err := ReadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]string)
+	for _, d := range m.Documents {
+		if prev, ok := seen[d.ID]; ok {
+			t.Errorf("ID %s у %s и %s", d.ID, prev, d.Pages[0].File)
+		}
+		seen[d.ID] = d.Pages[0].File
+	}
+	if len(m.Documents) != 5 {
+		t.Fatalf("документов %d, want 5", len(m.Documents))
+	}
+	same, _ := fileSHA256(filepath.Join(dir, "А_01_02_2023.jpg"))
+	want := map[string]string{
+		"А_01_02_2023.jpg": same[:8],
+		"Б_01_02_2023.jpg": same[:8] + "-2",
+		"В_01_02_2023.jpg": same[:8] + "-3",
+		"Д_01_02_2023.jpg": sum[:8] + "-2",
+	}
+	for id, file := range seen {
+		if w, ok := want[file]; ok && w != id {
+			t.Errorf("%s: ID = %q, want %q", file, id, w)
+		}
+	}
+}
+
+func TestMigratedIDFormat(t *testing.T) {
+	used := map[string]bool{"abcdef01": true, "abcdef01-2": true}
+	tests := []struct {
+		sum, want string
+	}{
+		{"0123456789abcdef", "01234567"},
+		{"abcdef0123456789", "abcdef01-3"},
+		{"short", "short"},
+	}
+	for _, tt := range tests {
+		if got := migratedDocID(tt.sum, used); got != tt.want {
+			t.Errorf("migratedDocID(%q) = %q, want %q", tt.sum, got, tt.want)
+		}
+	}
+}
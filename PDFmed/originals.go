@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ======== Originals ========
+
+// Исходные файлы (HEIC, PNG, PDF и т.д.) хранятся без изменений в
+// originals/<sha256[:2]>/<sha256><ext>. Документ ссылается на свой оригинал
+// полем Original, поэтому повторно добавленный файл занимает место один раз.
+
+// StoreOriginal копирует исходный файл в хранилище оригиналов и возвращает
+// путь относительно originalsBase. sum — sha256 содержимого src.
+func StoreOriginal(originalsBase, src, sum string) (string, error) {
+	rel := filepath.Join(sum[:2], sum+strings.ToLower(filepath.Ext(src)))
+	dst := filepath.Join(originalsBase, rel)
+	if _, err := os.Stat(dst); err == nil {
+		return rel, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return "", err
+	}
+	if err := copyFile(src, dst); err != nil {
+		return "", fmt.Errorf("не удалось сохранить оригинал %s: %w", src, err)
+	}
+	return rel, nil
+}
+
+// copyFile копирует src в dst через временный файл и сохраняет mtime.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	_ = os.Chtimes(tmp, info.ModTime(), info.ModTime())
+	return os.Rename(tmp, dst)
+}
+
+// gcOriginals удаляет оригиналы, на которые не ссылается ни один документ
+// архива и ни одна запись корзины. Возвращает число удалённых файлов.
+func gcOriginals(fotoBase, trashBase, originalsBase string) (int, error) {
+	used := make(map[string]bool)
+	all, err := selectDocuments(fotoBase, "", time.Time{}, time.Time{})
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range all {
+		for _, f := range documentFiles(&m.Doc) {
+			used[filepath.Clean(f.Path)] = true
+		}
+	}
+	trashed, err := listTrash(trashBase)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range trashed {
+		for _, f := range documentFiles(&e.Document) {
+			used[filepath.Clean(f.Path)] = true
+		}
+	}
+
+	removed := 0
+	err = filepath.WalkDir(originalsBase, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(originalsBase, path)
+		if err != nil {
+			return err
+		}
+		if used[rel] {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
+
+func runOriginal(args []string) {
+	fs := flag.NewFlagSet("original", flag.ExitOnError)
+	var outPath string
+	fs.StringVar(&outPath, "o", "", "скопировать оригинал в этот путь")
+	fs.StringVar(&outPath, "out", "", "скопировать оригинал в этот путь")
+	patient := patientFlag(fs)
+	ref := parseWithLeadingArg(fs, args)
+	usePatient(*patient, false)
+	if ref == "" {
+		log.Println("Ошибка: укажите ID документа или путь к его JPG.")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	m, err := resolveDocRef(baseFotoDir, ref)
+	if err != nil {
+		log.Fatalf("Ошибка: %v", err)
+	}
+	if m.Doc.Original == "" {
+		log.Fatalf("Для документа %s оригинал не сохранён (добавлен до появления хранилища originals/).", m.Doc.ID)
+	}
+	src := filepath.Join(baseOriginalsDir, m.Doc.Original)
+	if outPath == "" {
+		fmt.Println(src)
+		return
+	}
+	if info, err := os.Stat(outPath); err == nil && info.IsDir() {
+		name := m.Doc.SourceName
+		if name == "" {
+			name = filepath.Base(src)
+		}
+		outPath = filepath.Join(outPath, name)
+	}
+	if err := copyFile(src, outPath); err != nil {
+		log.Fatalf("Не удалось скопировать оригинал: %v", err)
+	}
+	log.Printf("Оригинал сохранён: %s\n", outPath)
+}
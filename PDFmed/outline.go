@@ -0,0 +1,144 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/phpdave11/gofpdf"
+)
+
+// ======== Навигация PDF ========
+
+// Оглавление (первые страницы PDF со ссылками на документы) включается
+// флагом --toc или переменной окружения PDFMED_TOC=1. Закладки (outline)
+// по годам и документам создаются всегда.
+var pdfTOC = os.Getenv("PDFMED_TOC") == "1"
+
+// Встроенный шрифт с кириллицей: стандартные шрифты PDF её не содержат.
+const pdfFont = "DejaVu"
+
+//go:embed fonts/DejaVuSansCondensed.ttf
+var fontRegular []byte
+
+//go:embed fonts/DejaVuSansCondensed-Bold.ttf
+var fontBold []byte
+
+func setupFonts(pdf *gofpdf.Fpdf) {
+	pdf.AddUTF8FontFromBytes(pdfFont, "", fontRegular)
+	pdf.AddUTF8FontFromBytes(pdfFont, "B", fontBold)
+}
+
+// tocEntry — строка оглавления: документ и номер его первой страницы в PDF.
+type tocEntry struct {
+	Doc   *Document
+	Page  int
+	Pages int
+	Link  int
+}
+
+// buildTOC группирует отсортированные страницы по документам. firstPage —
+// номер страницы PDF, на которой окажется items[0].
+func buildTOC(items []fotoItem, firstPage int) []tocEntry {
+	var entries []tocEntry
+	for i, it := range items {
+		if len(entries) > 0 && entries[len(entries)-1].Doc == it.Doc {
+			entries[len(entries)-1].Pages++
+			continue
+		}
+		entries = append(entries, tocEntry{Doc: it.Doc, Page: firstPage + i, Pages: 1})
+	}
+	return entries
+}
+
+const (
+	tocHeaderH = 16.0
+	tocRowH    = 7.0
+)
+
+// tocPageCount — сколько страниц займёт оглавление из n строк.
+func tocPageCount(n int, pageH, margin float64) int {
+	perPage := tocRowsPerPage(pageH, margin)
+	return (n + perPage - 1) / perPage
+}
+
+func tocRowsPerPage(pageH, margin float64) int {
+	return int((pageH - 2*margin - tocHeaderH) / tocRowH)
+}
+
+// drawTOC добавляет страницы оглавления. Каждая строка — дата, название,
+// число страниц и номер первой страницы документа; строка целиком является
+// ссылкой. Ссылки entries[i].Link должны быть созданы заранее через AddLink.
+func drawTOC(pdf *gofpdf.Fpdf, entries []tocEntry, title string, pageW, pageH, margin float64) {
+	const dateW, countW, pageNoW = 26.0, 20.0, 14.0
+	titleW := pageW - 2*margin - dateW - countW - pageNoW
+	perPage := tocRowsPerPage(pageH, margin)
+	for i, e := range entries {
+		if i%perPage == 0 {
+			pdf.AddPage()
+			pdf.SetFont(pdfFont, "B", 14)
+			if i == 0 {
+				pdf.Bookmark("Содержание", 0, 0)
+			}
+			pdf.SetXY(margin, margin)
+			pdf.CellFormat(pageW-2*margin, 10, title, "", 0, "L", false, 0, "")
+			pdf.SetFont(pdfFont, "", 10)
+			pdf.SetDrawColor(200, 200, 200)
+		}
+		y := margin + tocHeaderH + float64(i%perPage)*tocRowH
+		pdf.SetXY(margin, y)
+		pdf.CellFormat(dateW, tocRowH, e.Doc.Date, "B", 0, "L", false, 0, "")
+		pdf.CellFormat(titleW, tocRowH, fitText(pdf, e.Doc.Title, titleW-2), "B", 0, "L", false, 0, "")
+		pdf.CellFormat(countW, tocRowH, fmt.Sprintf("%d стр.", e.Pages), "B", 0, "R", false, 0, "")
+		pdf.CellFormat(pageNoW, tocRowH, strconv.Itoa(e.Page), "B", 0, "R", false, 0, "")
+		pdf.Link(margin, y, pageW-2*margin, tocRowH, e.Link)
+	}
+}
+
+// outline отслеживает текущие год и месяц при расстановке закладок.
+type outline struct {
+	months      bool // группировать документы года по месяцам
+	year, month int
+}
+
+var monthNames = []string{"Январь", "Февраль", "Март", "Апрель", "Май", "Июнь",
+	"Июль", "Август", "Сентябрь", "Октябрь", "Ноябрь", "Декабрь"}
+
+// bookmarkDocument добавляет закладки для документа, начинающегося на
+// текущей странице: уровень 0 — год (при его смене), затем, если включено,
+// месяц, и последним уровнем — сам документ.
+func (o *outline) bookmarkDocument(pdf *gofpdf.Fpdf, d *Document) {
+	// Bookmark кодирует текст в UTF-16 только при текущем UTF-8 шрифте.
+	pdf.SetFont(pdfFont, "", 9)
+	t := d.Time()
+	level := 1
+	if t.Year() != o.year {
+		pdf.Bookmark(strconv.Itoa(t.Year()), 0, 0)
+		o.year, o.month = t.Year(), 0
+	}
+	if o.months {
+		if m := int(t.Month()); m != o.month {
+			pdf.Bookmark(monthNames[m-1], 1, 0)
+			o.month = m
+		}
+		level = 2
+	}
+	label := d.Date
+	if d.Title != "" {
+		label += " — " + d.Title
+	}
+	pdf.Bookmark(label, level, 0)
+}
+
+// fitText обрезает строку с многоточием, чтобы она поместилась в ширину w.
+func fitText(pdf *gofpdf.Fpdf, s string, w float64) string {
+	if pdf.GetStringWidth(s) <= w {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 && pdf.GetStringWidth(string(r)+"…") > w {
+		r = r[:len(r)-1]
+	}
+	return string(r) + "…"
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ======== Пациенты ========
+
+// Без --patient архив лежит прямо в корне (foto/, pdf/, originals/, .trash/,
+// profile.json) — так, как было до появления профилей. С --patient <имя>
+// всё то же самое хранится в <корень>/<имя>/.
+
+// defaultPatient — пациент по умолчанию, если --patient не указан.
+var defaultPatient = os.Getenv("PDFMED_PATIENT")
+
+// currentPatient — slug выбранного пациента ("" — раскладка без профилей).
+var currentPatient string
+
+// patientFlag регистрирует -P/--patient в наборе флагов команды.
+func patientFlag(fs *flag.FlagSet) *string {
+	p := new(string)
+	fs.StringVar(p, "P", defaultPatient, "пациент (каталог в корне архива)")
+	fs.StringVar(p, "patient", defaultPatient, "пациент (каталог в корне архива)")
+	return p
+}
+
+// usePatient переключает каталоги архива на указанного пациента. Если
+// create == false, пациент должен уже существовать: создаёт пациентов
+// только profile, чтобы опечатка в -P не заводила новый архив.
+func usePatient(name string, create bool) {
+	slug := ""
+	if name != "" {
+		slug = Sanitize(name)
+		if err := checkPatientSlug(slug); err != nil {
+			log.Fatalf("Ошибка: недопустимое имя пациента %q: %v", name, err)
+		}
+	}
+	dir := patientDir(slug)
+	if slug != "" && !create {
+		if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+			known, _ := listPatients(archiveRoot)
+			if len(known) == 0 {
+				log.Fatalf("Пациент %s не найден. Создайте его: pdfmed profile --patient %s --name \"ФИО\"", slug, slug)
+			}
+			log.Fatalf("Пациент %s не найден. Известные пациенты: %s. Новый пациент создаётся так: pdfmed profile --patient %s --name \"ФИО\"", slug, strings.Join(known, ", "), slug)
+		}
+	}
+	currentPatient = slug
+	baseFotoDir = filepath.Join(dir, "foto")
+	basePDFDir = filepath.Join(dir, "pdf")
+	baseTrashDir = filepath.Join(dir, ".trash")
+	baseOriginalsDir = filepath.Join(dir, "originals")
+	profileFile = filepath.Join(dir, "profile.json")
+	specsFile = filepath.Join(dir, "specs.json")
+}
+
+func patientDir(slug string) string {
+	if slug == "" {
+		return archiveRoot
+	}
+	return filepath.Join(archiveRoot, slug)
+}
+
+// reservedDirs — каталоги корня архива, которые не являются пациентами.
+var reservedDirs = map[string]bool{"foto": true, "pdf": true, "originals": true, "trash": true}
+
+// checkPatientSlug проверяет, что каталог пациента лежит внутри корня и не
+// совпадает со служебными каталогами архива без профилей.
+func checkPatientSlug(slug string) error {
+	switch {
+	case slug == "":
+		return errors.New("пустое имя")
+	case strings.HasPrefix(slug, "."):
+		return errors.New("имя не может начинаться с точки")
+	case reservedDirs[strings.ToLower(slug)]:
+		return fmt.Errorf("%s — служебный каталог архива", slug)
+	}
+	return nil
+}
+
+// listPatients возвращает пациентов — подкаталоги корня, в которых есть
+// foto/ или profile.json.
+func listPatients(root string) ([]string, error) {
+	dirs, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, d := range dirs {
+		name := d.Name()
+		if !d.IsDir() || reservedDirs[name] || strings.HasPrefix(name, ".") {
+			continue
+		}
+		for _, marker := range []string{"foto", "profile.json"} {
+			if _, err := os.Stat(filepath.Join(root, name, marker)); err == nil {
+				out = append(out, name)
+				break
+			}
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// allPatients — все пациенты архива; "" означает архив без профилей в
+// корне и включается, если в корне есть foto/.
+func allPatients() []string {
+	var out []string
+	if _, err := os.Stat(filepath.Join(archiveRoot, "foto")); err == nil {
+		out = append(out, "")
+	}
+	known, err := listPatients(archiveRoot)
+	if err != nil {
+		log.Fatalf("Не удалось прочитать корень архива: %v", err)
+	}
+	return append(out, known...)
+}
+
+// patientLabel — подпись пациента для вывода.
+func patientLabel(slug string) string {
+	if slug == "" {
+		return "(без профиля)"
+	}
+	return slug
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// killGroupOnCancel: вне Unix завершается только сама команда
+// (поведение exec.CommandContext по умолчанию).
+func killGroupOnCancel(cmd *exec.Cmd) {}
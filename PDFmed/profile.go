@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// ======== Профиль пациента ========
+
+// profileFile лежит в корне архива (или каталоге пациента) рядом с foto/ и
+// pdf/; данные из него выводятся на обложке PDF.
+var profileFile = "profile.json"
+
+type Profile struct {
+	Name      string `json:"name,omitempty"`
+	BirthDate string `json:"birth_date,omitempty"` // DD-MM-YYYY
+}
+
+// ReadProfile читает профиль; отсутствие файла — не ошибка.
+func ReadProfile(path string) (Profile, error) {
+	var p Profile
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+func WriteProfile(path string, p Profile) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func runProfile(args []string) {
+	fs := flag.NewFlagSet("profile", flag.ExitOnError)
+	var name, birth string
+	fs.StringVar(&name, "name", "", "ФИО пациента")
+	fs.StringVar(&birth, "birth", "", "дата рождения DD-MM-YYYY")
+	patient := patientFlag(fs)
+	_ = fs.Parse(args)
+	// Новый пациент создаётся только здесь и только при заполнении профиля.
+	usePatient(*patient, name != "" || birth != "")
+
+	p, err := ReadProfile(profileFile)
+	if err != nil {
+		log.Fatalf("Не удалось прочитать профиль: %v", err)
+	}
+	if name == "" && birth == "" {
+		if p == (Profile{}) {
+			fmt.Println("Профиль не заполнен. Укажите: pdfmed profile --name \"ФИО\" [--birth DD-MM-YYYY]")
+			return
+		}
+		fmt.Printf("Пациент: %s\n", p.Name)
+		if p.BirthDate != "" {
+			fmt.Printf("Дата рождения: %s\n", p.BirthDate)
+		}
+		return
+	}
+	if name != "" {
+		p.Name = name
+	}
+	if birth != "" {
+		date, _, err := ParseDate(birth)
+		if err != nil {
+			log.Fatalf("Неверный формат даты рождения: %v", err)
+		}
+		p.BirthDate = FormatDate(date)
+	}
+	if err := os.MkdirAll(filepath.Dir(profileFile), 0o755); err != nil {
+		log.Fatalf("Не удалось создать каталог пациента: %v", err)
+	}
+	if err := WriteProfile(profileFile, p); err != nil {
+		log.Fatalf("Не удалось сохранить профиль: %v", err)
+	}
+	log.Println("Профиль сохранён. Обложки обновятся при следующей регенерации (pdfmed regen).")
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ======== Поиск документов ========
+
+// docMatch — найденный документ и каталог его специализации.
+type docMatch struct {
+	Spec string
+	Doc  Document
+}
+
+// Dir возвращает каталог специализации документа.
+func (m docMatch) Dir(fotoBase string) string {
+	return filepath.Join(fotoBase, m.Spec)
+}
+
+// resolveDocRef находит документ по ID (или однозначному префиксу ID)
+// либо по пути к одной из его JPG-страниц.
+func resolveDocRef(fotoBase, ref string) (docMatch, error) {
+	if isJPGName(ref) || strings.ContainsRune(ref, os.PathSeparator) {
+		return findDocByPath(fotoBase, ref)
+	}
+	return findDocByID(fotoBase, ref)
+}
+
+// findDocByID ищет документ по ID во всех специализациях.
+func findDocByID(fotoBase, id string) (docMatch, error) {
+	id = strings.ToLower(strings.TrimSpace(id))
+	if id == "" {
+		return docMatch{}, fmt.Errorf("пустой ID документа")
+	}
+	all, err := selectDocuments(fotoBase, "", time.Time{}, time.Time{})
+	if err != nil {
+		return docMatch{}, err
+	}
+	var found []docMatch
+	for _, m := range all {
+		if m.Doc.ID == id {
+			return m, nil
+		}
+		if strings.HasPrefix(m.Doc.ID, id) {
+			found = append(found, m)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return docMatch{}, fmt.Errorf("документ %s не найден", id)
+	case 1:
+		return found[0], nil
+	default:
+		return docMatch{}, fmt.Errorf("ID %s неоднозначен: подходит %d документов", id, len(found))
+	}
+}
+
+// findDocByPath ищет документ, которому принадлежит JPG-страница path.
+func findDocByPath(fotoBase, path string) (docMatch, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return docMatch{}, err
+	}
+	absBase, err := filepath.Abs(fotoBase)
+	if err != nil {
+		return docMatch{}, err
+	}
+	dir := filepath.Dir(absPath)
+	if filepath.Dir(dir) != absBase {
+		return docMatch{}, fmt.Errorf("%s не находится в %s/<специализация>", path, fotoBase)
+	}
+	spec := filepath.Base(dir)
+	m, _, err := ReadManifest(filepath.Join(fotoBase, spec))
+	if err != nil {
+		return docMatch{}, err
+	}
+	name := filepath.Base(absPath)
+	for _, d := range m.Documents {
+		for _, p := range d.Pages {
+			if p.File == name {
+				return docMatch{Spec: spec, Doc: d}, nil
+			}
+		}
+	}
+	return docMatch{}, fmt.Errorf("файл %s не найден в манифесте %s", name, spec)
+}
+
+// selectDocuments возвращает документы специализации specSlug (или всех,
+// если specSlug пуст), попадающие в диапазон дат, в порядке collectJPGsSorted.
+func selectDocuments(fotoBase, specSlug string, from, to time.Time) ([]docMatch, error) {
+	var slugs []string
+	if specSlug != "" {
+		if _, err := os.Stat(filepath.Join(fotoBase, specSlug)); err != nil {
+			return nil, fmt.Errorf("специализация %s не найдена", specSlug)
+		}
+		slugs = []string{specSlug}
+	} else {
+		var err error
+		if slugs, err = listSpecSlugs(fotoBase); err != nil {
+			return nil, err
+		}
+	}
+	var out []docMatch
+	for _, slug := range slugs {
+		items, err := collectJPGsSorted(filepath.Join(fotoBase, slug))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", slug, err)
+		}
+		var last *Document
+		for _, it := range items {
+			if it.Doc == last || !inDateRange(it.Date, from, to) {
+				continue
+			}
+			last = it.Doc
+			out = append(out, docMatch{Spec: slug, Doc: *it.Doc})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// ======== Реестр специализаций ========
+
+// specsFile — реестр специализаций пациента (рядом с foto/). Каталоги
+// foto/<slug>, которых нет в реестре, считаются специализациями с именем,
+// равным slug.
+var specsFile = "specs.json"
+
+// SpecEntry — специализация: отображаемое имя, slug каталога и синонимы.
+type SpecEntry struct {
+	Name    string   `json:"name"`
+	Slug    string   `json:"slug"`
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+type SpecRegistry struct {
+	Specs []SpecEntry `json:"specs"`
+}
+
+// LoadSpecRegistry читает реестр и дополняет его каталогами из fotoBase
+// (при пустом fotoBase — только реестр).
+func LoadSpecRegistry(path, fotoBase string) (*SpecRegistry, error) {
+	r := &SpecRegistry{}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, r); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if fotoBase == "" {
+		return r, nil
+	}
+	slugs, err := listSpecSlugs(fotoBase)
+	if err != nil {
+		return nil, err
+	}
+	for _, slug := range slugs {
+		if r.bySlug(slug) == nil {
+			r.Specs = append(r.Specs, SpecEntry{Name: slug, Slug: slug})
+		}
+	}
+	return r, nil
+}
+
+func (r *SpecRegistry) Save(path string) error {
+	if r.Specs == nil {
+		r.Specs = []SpecEntry{} // «specs»: [], а не null
+	}
+	sort.Slice(r.Specs, func(i, j int) bool { return r.Specs[i].Slug < r.Specs[j].Slug })
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (r *SpecRegistry) bySlug(slug string) *SpecEntry {
+	for i := range r.Specs {
+		if r.Specs[i].Slug == slug {
+			return &r.Specs[i]
+		}
+	}
+	return nil
+}
+
+// Resolve ищет специализацию по имени, slug или синониму без учёта регистра.
+func (r *SpecRegistry) Resolve(input string) *SpecEntry {
+	key := specKey(input)
+	for i := range r.Specs {
+		for _, n := range r.Specs[i].names() {
+			if specKey(n) == key {
+				return &r.Specs[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Suggest возвращает имена специализаций, близкие к input по расстоянию
+// Левенштейна, — от ближайшей к дальней.
+func (r *SpecRegistry) Suggest(input string) []string {
+	key := specKey(input)
+	limit := utf8.RuneCountInString(key)/3 + 1
+	if limit < 2 {
+		limit = 2
+	}
+	best := make(map[string]int)
+	for _, s := range r.Specs {
+		for _, n := range s.names() {
+			d := levenshtein(key, specKey(n))
+			// Совпадение по началу слова («Эндокринолог» → «Эндокринология»).
+			if strings.HasPrefix(specKey(n), key) || strings.HasPrefix(key, specKey(n)) {
+				d = min(d, 1)
+			}
+			if d > limit {
+				continue
+			}
+			if old, ok := best[s.Name]; !ok || d < old {
+				best[s.Name] = d
+			}
+		}
+	}
+	out := make([]string, 0, len(best))
+	for name := range best {
+		out = append(out, name)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if best[out[i]] != best[out[j]] {
+			return best[out[i]] < best[out[j]]
+		}
+		return out[i] < out[j]
+	})
+	return out
+}
+
+func (s SpecEntry) names() []string {
+	return append([]string{s.Name, s.Slug}, s.Aliases...)
+}
+
+// specKey нормализует имя для сравнения: регистр, пробелы и «ё».
+func specKey(s string) string {
+	s = strings.ToLower(Sanitize(s))
+	s = strings.ReplaceAll(s, "ё", "е")
+	return strings.ReplaceAll(s, "-", "_")
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// resolveSpec находит специализацию по пользовательскому вводу. Если она
+// неизвестна, а create == true и похожих нет, она добавляется в реестр;
+// при похожих вариантах команда завершается с подсказкой.
+func resolveSpec(input string, create bool) SpecEntry {
+	s, isNew := findSpec(input, create, nil)
+	if isNew {
+		if err := registerSpec(s); err != nil {
+			log.Fatalf("Не удалось сохранить реестр специализаций: %v", err)
+		}
+	}
+	return s
+}
+
+// findSpec — то же, что resolveSpec, но новая специализация в реестр не
+// записывается: второе значение сообщает, что её нужно зарегистрировать
+// через registerSpec, когда в неё действительно что-то добавлено. pending —
+// новые специализации, уже найденные в том же пакете add: ввод,
+// совпадающий с одной из них по имени или регистру, получает её же slug.
+func findSpec(input string, create bool, pending []SpecEntry) (SpecEntry, bool) {
+	r, err := LoadSpecRegistry(specsFile, baseFotoDir)
+	if err != nil {
+		log.Fatalf("Не удалось прочитать реестр специализаций: %v", err)
+	}
+	if s := r.Resolve(input); s != nil {
+		return *s, false
+	}
+	batch := &SpecRegistry{Specs: pending}
+	if s := batch.Resolve(input); s != nil {
+		return *s, true
+	}
+	r.Specs = append(r.Specs, pending...)
+	hint := ""
+	if sug := r.Suggest(input); len(sug) > 0 {
+		hint = fmt.Sprintf(" Возможно, имелось в виду: %s.", strings.Join(sug, ", "))
+		if create {
+			hint += " Чтобы всё же создать новую, добавьте её: pdfmed spec add \"" + input + "\"."
+		}
+		log.Fatalf("Неизвестная специализация «%s».%s", input, hint)
+	}
+	if !create {
+		log.Fatalf("Неизвестная специализация «%s».", input)
+	}
+	return SpecEntry{Name: strings.TrimSpace(input), Slug: Sanitize(input)}, true
+}
+
+// registerSpec добавляет специализацию в реестр, если её там ещё нет.
+// Запись, которую LoadSpecRegistry достроила по уже созданному каталогу
+// foto/<slug>, заменяется: у неё нет настоящего имени.
+func registerSpec(s SpecEntry) error {
+	r, err := LoadSpecRegistry(specsFile, "")
+	if err != nil {
+		return err
+	}
+	if r.bySlug(s.Slug) != nil {
+		return nil
+	}
+	if r, err = LoadSpecRegistry(specsFile, baseFotoDir); err != nil {
+		return err
+	}
+	if cur := r.bySlug(s.Slug); cur != nil {
+		*cur = s
+	} else {
+		r.Specs = append(r.Specs, s)
+	}
+	if err := r.Save(specsFile); err != nil {
+		return err
+	}
+	log.Printf("Новая специализация: %s\n", s.Name)
+	return nil
+}
+
+// unregisterSpec убирает специализацию из реестра.
+func unregisterSpec(slug string) error {
+	r, err := LoadSpecRegistry(specsFile, baseFotoDir)
+	if err != nil {
+		return err
+	}
+	specs := make([]SpecEntry, 0, len(r.Specs))
+	for _, s := range r.Specs {
+		if s.Slug != slug {
+			specs = append(specs, s)
+		}
+	}
+	if len(specs) == len(r.Specs) {
+		return nil
+	}
+	r.Specs = specs
+	return r.Save(specsFile)
+}
+
+// lookupSpecSlug — slug специализации по вводу пользователя без создания
+// и без завершения программы: для фильтров, где неизвестная специализация
+// просто ничего не находит.
+func lookupSpecSlug(input string) string {
+	if r, err := LoadSpecRegistry(specsFile, baseFotoDir); err == nil {
+		if s := r.Resolve(input); s != nil {
+			return s.Slug
+		}
+	}
+	return Sanitize(input)
+}
+
+// specDisplayName — отображаемое имя специализации для обложки и заголовков.
+func specDisplayName(slug string) string {
+	r, err := LoadSpecRegistry(specsFile, baseFotoDir)
+	if err != nil {
+		return slug
+	}
+	if s := r.bySlug(slug); s != nil && s.Name != "" {
+		return s.Name
+	}
+	return slug
+}
+
+func runSpec(args []string) {
+	sub := "list"
+	if len(args) > 0 {
+		sub, args = args[0], args[1:]
+	}
+	switch sub {
+	case "list", "ls":
+		fs := flag.NewFlagSet("spec list", flag.ExitOnError)
+		patient := patientFlag(fs)
+		_ = fs.Parse(args)
+		usePatient(*patient, false)
+		r, err := LoadSpecRegistry(specsFile, baseFotoDir)
+		if err != nil {
+			log.Fatalf("Не удалось прочитать реестр специализаций: %v", err)
+		}
+		if len(r.Specs) == 0 {
+			fmt.Println("Специализаций пока нет.")
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "НАЗВАНИЕ\tКАТАЛОГ\tСИНОНИМЫ")
+		for _, s := range r.Specs {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Name, s.Slug, strings.Join(s.Aliases, ", "))
+		}
+		_ = tw.Flush()
+	case "add":
+		fs := flag.NewFlagSet("spec add", flag.ExitOnError)
+		var aliases string
+		fs.StringVar(&aliases, "alias", "", "синонимы через запятую")
+		patient := patientFlag(fs)
+		name := parseWithLeadingArg(fs, args)
+		usePatient(*patient, false)
+		if name == "" {
+			log.Fatalf("Ошибка: укажите название специализации.")
+		}
+		updateSpecRegistry(func(r *SpecRegistry) error {
+			if s := r.Resolve(name); s != nil {
+				return fmt.Errorf("специализация «%s» уже есть (%s)", name, s.Name)
+			}
+			r.Specs = append(r.Specs, SpecEntry{Name: name, Slug: Sanitize(name)})
+			return addAliases(r, &r.Specs[len(r.Specs)-1], splitList(aliases))
+		})
+		log.Printf("Специализация добавлена: %s\n", name)
+	case "alias":
+		fs := flag.NewFlagSet("spec alias", flag.ExitOnError)
+		patient := patientFlag(fs)
+		pos := parseInterspersed(fs, args)
+		usePatient(*patient, false)
+		if len(pos) < 2 {
+			log.Fatalf("Ошибка: укажите специализацию и синонимы: pdfmed spec alias <специализация> <синоним>...")
+		}
+		name, aliases := pos[0], pos[1:]
+		updateSpecRegistry(func(r *SpecRegistry) error {
+			s := r.Resolve(name)
+			if s == nil {
+				return fmt.Errorf("неизвестная специализация «%s»", name)
+			}
+			return addAliases(r, s, aliases)
+		})
+		log.Println("Синонимы сохранены.")
+	case "merge":
+		fs := flag.NewFlagSet("spec merge", flag.ExitOnError)
+		patient := patientFlag(fs)
+		_ = fs.Parse(args)
+		usePatient(*patient, false)
+		if fs.NArg() != 2 {
+			log.Fatalf("Ошибка: использование: pdfmed spec merge <откуда> <куда>")
+		}
+		from := resolveSpec(fs.Arg(0), false)
+		to := resolveSpec(fs.Arg(1), false)
+		if from.Slug == to.Slug {
+			log.Fatalf("Ошибка: это одна и та же специализация (%s).", to.Name)
+		}
+		n, err := MergeSpecs(baseFotoDir, from, to)
+		if err != nil {
+			log.Fatalf("Не удалось объединить %s и %s: %v", from.Name, to.Name, err)
+		}
+		log.Printf("Перенесено документов: %d (%s → %s)\n", n, from.Name, to.Name)
+		regenerateSpecs(map[string]bool{to.Slug: true})
+		log.Println("Готово.")
+	default:
+		log.Printf("Неизвестная подкоманда spec: %s (ожидается list, add, alias или merge)\n", sub)
+		os.Exit(1)
+	}
+}
+
+func updateSpecRegistry(fn func(r *SpecRegistry) error) {
+	r, err := LoadSpecRegistry(specsFile, baseFotoDir)
+	if err != nil {
+		log.Fatalf("Не удалось прочитать реестр специализаций: %v", err)
+	}
+	if err := fn(r); err != nil {
+		log.Fatalf("Ошибка: %v", err)
+	}
+	if err := r.Save(specsFile); err != nil {
+		log.Fatalf("Не удалось сохранить реестр специализаций: %v", err)
+	}
+}
+
+// addAliases добавляет синонимы, не допуская пересечений с другими
+// специализациями.
+func addAliases(r *SpecRegistry, s *SpecEntry, aliases []string) error {
+	for _, a := range aliases {
+		if other := r.Resolve(a); other != nil {
+			if other.Slug == s.Slug {
+				continue
+			}
+			return fmt.Errorf("«%s» уже относится к специализации %s", a, other.Name)
+		}
+		s.Aliases = append(s.Aliases, a)
+	}
+	return nil
+}
+
+// MergeSpecs переносит все документы специализации from в to (страницы
+// переименовываются как при edit --spec), удаляет каталоги from и делает её
+// имя и синонимы синонимами to. Возвращает число перенесённых документов.
+func MergeSpecs(fotoBase string, from, to SpecEntry) (int, error) {
+	srcDir := filepath.Join(fotoBase, from.Slug)
+	moved := 0
+	if _, err := os.Stat(srcDir); err == nil {
+		m, _, err := ReadManifest(srcDir)
+		if err != nil {
+			return 0, err
+		}
+		for _, d := range append([]Document(nil), m.Documents...) {
+			if _, err := EditDocument(fotoBase, docMatch{Spec: from.Slug, Doc: d}, docEdit{Spec: to.Slug}); err != nil {
+				return moved, fmt.Errorf("документ %s: %w", d.ID, err)
+			}
+			moved++
+		}
+	}
+	if err := retagTrash(baseTrashDir, from.Slug, to.Slug); err != nil {
+		return moved, err
+	}
+	_ = os.Remove(filepath.Join(srcDir, manifestFileName))
+	if err := os.Remove(srcDir); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return moved, fmt.Errorf("в %s остались посторонние файлы: %w", srcDir, err)
+	}
+	if err := os.RemoveAll(filepath.Join(basePDFDir, from.Slug)); err != nil {
+		return moved, err
+	}
+
+	r, err := LoadSpecRegistry(specsFile, fotoBase)
+	if err != nil {
+		return moved, err
+	}
+	var kept []SpecEntry
+	for _, s := range r.Specs {
+		if s.Slug != from.Slug {
+			kept = append(kept, s)
+		}
+	}
+	r.Specs = kept
+	target := r.bySlug(to.Slug)
+	if target == nil {
+		r.Specs = append(r.Specs, to)
+		target = &r.Specs[len(r.Specs)-1]
+	}
+	for _, a := range from.names() {
+		if r.Resolve(a) == nil {
+			target.Aliases = append(target.Aliases, a)
+		}
+	}
+	return moved, r.Save(specsFile)
+}
+
+// retagTrash переписывает специализацию у документов в корзине, чтобы
+// restore вернул их уже в объединённую специализацию.
+func retagTrash(trashBase, from, to string) error {
+	dirs, err := os.ReadDir(trashBase)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		path := filepath.Join(trashBase, d.Name(), trashEntryFile)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var e trashEntry
+		if json.Unmarshal(data, &e) != nil || e.Spec != from {
+			continue
+		}
+		e.Spec = to
+		out, err := json.MarshalIndent(e, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, append(out, '\n'), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// useTestArchive переключает каталоги архива на временный каталог.
+func useTestArchive(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	saved := []*string{&baseFotoDir, &basePDFDir, &baseTrashDir, &baseOriginalsDir, &specsFile, &profileFile}
+	old := make([]string, len(saved))
+	for i, p := range saved {
+		old[i] = *p
+	}
+	t.Cleanup(func() {
+		for i, p := range saved {
+			*p = old[i]
+		}
+	})
+	baseFotoDir = filepath.Join(root, "foto")
+	basePDFDir = filepath.Join(root, "pdf")
+	baseTrashDir = filepath.Join(root, ".trash")
+	baseOriginalsDir = filepath.Join(root, "originals")
+	specsFile = filepath.Join(root, "specs.json")
+	profileFile = filepath.Join(root, "profile.json")
+	return root
+}
+
+func testRegistry() *SpecRegistry {
+	return &SpecRegistry{Specs: []SpecEntry{
+		{Name: "Эндокринология", Slug: "endo", Aliases: []string{"эндо", "щитовидка"}},
+		{Name: "Кардиология", Slug: "Кардиология"},
+		{Name: "Общий анализ крови", Slug: "Общий_анализ_крови"},
+		{Name: "Лёгкие", Slug: "lungs"},
+		{Name: "ЛОР", Slug: "ЛОР"},
+	}}
+}
+
+func TestSpecResolve(t *testing.T) {
+	r := testRegistry()
+	tests := []struct {
+		input, slug string
+	}{
+		{"Эндокринология", "endo"},
+		{"эндокринология", "endo"},
+		{"ЭНДОКРИНОЛОГИЯ", "endo"},
+		{"endo", "endo"},
+		{"ENDO", "endo"},
+		{"эндо", "endo"},
+		{"Щитовидка", "endo"},
+		{"  кардиология ", "Кардиология"},
+		{"общий анализ крови", "Общий_анализ_крови"},
+		{"Общий_анализ_крови", "Общий_анализ_крови"},
+		{"общий-анализ-крови", "Общий_анализ_крови"},
+		{"легкие", "lungs"},
+		{"лор", "ЛОР"},
+		{"Неврология", ""},
+		{"эндок", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if s := r.Resolve(tt.input); s != nil {
+			got = s.Slug
+		}
+		if got != tt.slug {
+			t.Errorf("Resolve(%q) = %q, want %q", tt.input, got, tt.slug)
+		}
+	}
+}
+
+func TestSpecSuggest(t *testing.T) {
+	r := testRegistry()
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"Эндокринолгия", []string{"Эндокринология"}}, // пропущена буква
+		{"Эндокринолог", []string{"Эндокринология"}},  // начало слова
+		{"Кордиалогия", []string{"Кардиология"}},      // две опечатки
+		{"щитовидкa", []string{"Эндокринология"}},     // латинская «a» в синониме
+		{"ЛОРР", []string{"ЛОР"}},
+		{"Стоматология", nil},
+		{"xyz", nil},
+	}
+	for _, tt := range tests {
+		got := r.Suggest(tt.input)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("Suggest(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"лор", "", 3},
+		{"кардиология", "кардиология", 0},
+		{"кардиология", "кардиологя", 1},
+		{"кот", "ток", 2},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestFindSpecPending(t *testing.T) {
+	useTestArchive(t)
+	if err := testRegistry().Save(specsFile); err != nil {
+		t.Fatal(err)
+	}
+	var pending []SpecEntry
+	tests := []struct {
+		input  string
+		slug   string
+		isNew  bool
+		pushed bool
+	}{
+		{"эндо", "endo", false, false},
+		{"Окулист", "Окулист", true, true},
+		{"окулист", "Окулист", true, false},
+		{"ОКУЛИСТ", "Окулист", true, false},
+		{"Аллергология", "Аллергология", true, true},
+	}
+	for _, tt := range tests {
+		s, isNew := findSpec(tt.input, true, pending)
+		if s.Slug != tt.slug || isNew != tt.isNew {
+			t.Errorf("findSpec(%q) = %q, %v; want %q, %v", tt.input, s.Slug, isNew, tt.slug, tt.isNew)
+		}
+		if tt.pushed {
+			pending = append(pending, s)
+		}
+	}
+	data, err := os.ReadFile(specsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "Окулист") {
+		t.Error("findSpec записал новую специализацию в реестр")
+	}
+}
+
+func TestRegisterSpec(t *testing.T) {
+	useTestArchive(t)
+	s := SpecEntry{Name: "Окулист", Slug: "Окулист"}
+	// Каталог уже создан add, LoadSpecRegistry достраивает по нему запись.
+	if err := os.MkdirAll(filepath.Join(baseFotoDir, s.Slug), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := registerSpec(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := LoadSpecRegistry(specsFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Specs) != 1 || r.Specs[0].Name != "Окулист" || r.Specs[0].Slug != "Окулист" {
+		t.Fatalf("реестр = %+v", r.Specs)
+	}
+
+	if err := os.Remove(filepath.Join(baseFotoDir, s.Slug)); err != nil {
+		t.Fatal(err)
+	}
+	if err := unregisterSpec(s.Slug); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(specsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"specs": []`) {
+		t.Errorf("specs.json после удаления последней специализации:\n%s", data)
+	}
+}
+
+func TestMergeSpecs(t *testing.T) {
+	useTestArchive(t)
+	from := SpecEntry{Name: "Эндо", Slug: "Эндо", Aliases: []string{"щитовидка"}}
+	to := SpecEntry{Name: "Эндокринология", Slug: "endo"}
+	if err := (&SpecRegistry{Specs: []SpecEntry{from, to}}).Save(specsFile); err != nil {
+		t.Fatal(err)
+	}
+	fromDir := filepath.Join(baseFotoDir, from.Slug)
+	toDir := filepath.Join(baseFotoDir, to.Slug)
+	for _, d := range []string{fromDir, toDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Одинаковые имена страниц в обеих специализациях.
+	writeFiles(t, fromDir, map[string]string{"Эндо_01_02_2023.jpg": "a", "УЗИ_05_05_2023_page_000.jpg": "b0", "УЗИ_05_05_2023_page_001.jpg": "b1"})
+	writeFiles(t, toDir, map[string]string{"Эндо_01_02_2023.jpg": "c"})
+	if err := os.MkdirAll(filepath.Join(basePDFDir, from.Slug), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := MergeSpecs(baseFotoDir, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("перенесено %d документов, want 2", n)
+	}
+	for _, dir := range []string{fromDir, filepath.Join(basePDFDir, from.Slug)} {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("%s не удалён", dir)
+		}
+	}
+
+	m, _, err := ReadManifest(toDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := docFiles(m); len(got) != 3 {
+		t.Fatalf("документы в %s: %q", toDir, got)
+	}
+	for _, f := range []string{"Эндо_01_02_2023.jpg", "Эндо_01_02_2023_02.jpg", "УЗИ_05_05_2023_page_000.jpg", "УЗИ_05_05_2023_page_001.jpg"} {
+		if _, err := os.Stat(filepath.Join(toDir, f)); err != nil {
+			t.Errorf("нет страницы %s", f)
+		}
+	}
+	if got := readContent(t, filepath.Join(toDir, "Эндо_01_02_2023.jpg")); got != "c" {
+		t.Errorf("страница целевой специализации перезаписана: %q", got)
+	}
+
+	r, err := LoadSpecRegistry(specsFile, baseFotoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Specs) != 1 {
+		t.Fatalf("реестр = %+v", r.Specs)
+	}
+	for _, name := range []string{"Эндо", "щитовидка", "Эндокринология"} {
+		if s := r.Resolve(name); s == nil || s.Slug != to.Slug {
+			t.Errorf("Resolve(%q) после merge = %+v", name, s)
+		}
+	}
+	if !slices.Contains(r.Specs[0].Aliases, "щитовидка") {
+		t.Errorf("синонимы = %q", r.Specs[0].Aliases)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// ======== Теги ========
+
+// Документ лежит в одной специализации, но может нести сколько угодно тегов
+// (орган, врач, вид исследования, клиника). Для каждого тега собирается
+// отдельный PDF «pdf/по тегам/<тег>.pdf» из документов всех специализаций —
+// изображения при этом не копируются.
+
+// tagsPDFDir — каталог PDF тегов. В имени есть пробел, а Sanitize заменяет
+// пробелы, поэтому ни одна специализация не получит pdf/<slug> с тем же
+// именем и очистка устаревших PDF тегов не тронет её PDF.
+const tagsPDFDir = "по тегам"
+
+// legacyTagsPDFDir — прежний каталог PDF тегов, совпадавший с
+// pdf/<slug> специализации «tags».
+const legacyTagsPDFDir = "tags"
+
+// tagKey — ключ тега: теги, дающие одно имя файла PDF (регистр, пробелы
+// и подчёркивания), считаются одним тегом.
+func tagKey(tag string) string {
+	return strings.ToLower(Sanitize(tag))
+}
+
+// normalizeTags убирает пустые теги и повторы без учёта регистра.
+func normalizeTags(tags []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		key := strings.ToLower(t)
+		if t == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, t)
+	}
+	return out
+}
+
+func (d *Document) HasTag(tag string) bool {
+	for _, t := range d.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutTags возвращает теги за вычетом remove (без учёта регистра).
+func withoutTags(tags, remove []string) []string {
+	var out []string
+	for _, t := range tags {
+		drop := false
+		for _, r := range remove {
+			if strings.EqualFold(t, strings.TrimSpace(r)) {
+				drop = true
+				break
+			}
+		}
+		if !drop {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// collectTags группирует страницы документов всех специализаций по тегам.
+// Ключ — tagKey тега, display — тег в том виде, в каком он встретился
+// первым.
+func collectTags(fotoBase string) (map[string][]fotoItem, map[string]string, error) {
+	slugs, err := listSpecSlugs(fotoBase)
+	if err != nil {
+		return nil, nil, err
+	}
+	items := make(map[string][]fotoItem)
+	display := make(map[string]string)
+	for _, slug := range slugs {
+		dir := filepath.Join(fotoBase, slug)
+		m, _, err := ReadManifest(dir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", slug, err)
+		}
+		for i := range m.Documents {
+			d := &m.Documents[i]
+			seen := make(map[string]bool)
+			for _, t := range d.Tags {
+				key := tagKey(t)
+				if seen[key] {
+					continue // «a b» и «a_b» у одного документа
+				}
+				seen[key] = true
+				if _, ok := display[key]; !ok {
+					display[key] = t
+				}
+				for pi, p := range d.Pages {
+					items[key] = append(items[key], fotoItem{
+						Path: filepath.Join(dir, p.File),
+						Name: p.File,
+						Date: d.Time(),
+						Doc:  d,
+						Page: pi,
+						Spec: slug,
+					})
+				}
+			}
+		}
+	}
+	for _, its := range items {
+		sortFotoItems(its)
+	}
+	return items, display, nil
+}
+
+func tagPDFPath(pdfBase, tag string) string {
+	return filepath.Join(pdfBase, tagsPDFDir, Sanitize(tag)+".pdf")
+}
+
+// regenerateTags пересобирает PDF всех тегов (параллельно, до jobs сразу) и
+// удаляет PDF тегов, которые больше ни у одного документа не встречаются.
+func regenerateTags(fotoBase, pdfBase string) error {
+	items, display, err := collectTags(fotoBase)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool)
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		keep[filepath.Base(tagPDFPath(pdfBase, display[key]))] = true
+	}
+	var errs []error
+	runJobs(len(keys), func(i int) error {
+		key := keys[i]
+		job := pdfJob{Title: "#" + display[key], Attach: attachOriginals, AttachConfig: configAttach, ShowSpec: true, Out: tagPDFPath(pdfBase, display[key])}
+		return renderPDF(items[key], job)
+	}, func(i int, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("тег %s: %w", display[keys[i]], err))
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	removeLegacyTagPDFs(fotoBase, pdfBase)
+	dir := filepath.Join(pdfBase, tagsPDFDir)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".pdf") && !keep[e.Name()] {
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				return err
+			}
+			_ = os.Remove(fingerprintPath(filepath.Join(dir, e.Name())))
+			log.Printf("PDF удалён: %s\n", filepath.Join(dir, e.Name()))
+		}
+	}
+	return nil
+}
+
+// removeLegacyTagPDFs удаляет PDF тегов из прежнего каталога pdf/tags/,
+// если это не каталог PDF специализации «tags».
+func removeLegacyTagPDFs(fotoBase, pdfBase string) {
+	if _, err := os.Stat(filepath.Join(fotoBase, legacyTagsPDFDir)); err == nil {
+		return
+	}
+	dir := filepath.Join(pdfBase, legacyTagsPDFDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".pdf") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if err := os.Remove(path); err == nil {
+			_ = os.Remove(fingerprintPath(path))
+			log.Printf("PDF удалён: %s (PDF тегов теперь в %s)\n", path, filepath.Join(pdfBase, tagsPDFDir))
+		}
+	}
+	_ = os.Remove(dir) // только если пуст
+}
+
+// runTags выводит теги архива с числом документов и путём к PDF.
+func runTags(args []string) {
+	fs := flag.NewFlagSet("tags", flag.ExitOnError)
+	patient := patientFlag(fs)
+	_ = fs.Parse(args)
+	usePatient(*patient, false)
+
+	items, display, err := collectTags(baseFotoDir)
+	if err != nil {
+		log.Fatalf("Не удалось прочитать архив: %v", err)
+	}
+	if len(items) == 0 {
+		fmt.Println("Тегов пока нет. Добавьте их: pdfmed add ... --tag УЗИ или pdfmed edit <id> --tag УЗИ")
+		return
+	}
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ТЕГ\tДОК.\tСТР.\tPDF")
+	for _, key := range keys {
+		docs := make(map[*Document]bool)
+		for _, it := range items[key] {
+			docs[it.Doc] = true
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", display[key], len(docs), len(items[key]), tagPDFPath(basePDFDir, display[key]))
+	}
+	_ = tw.Flush()
+}
+
+// listFlag регистрирует повторяемый флаг со списком значений через запятую.
+func listFlag(fs *flag.FlagSet, name, usage string, dst *[]string) {
+	fs.Func(name, usage, func(v string) error {
+		*dst = append(*dst, splitList(v)...)
+		return nil
+	})
+}
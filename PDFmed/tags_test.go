@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCollectTags(t *testing.T) {
+	useTestArchive(t)
+	docs := map[string][]Document{
+		"tags": {
+			{ID: "a", Tags: []string{"a b", "a_b"}, Pages: []Page{{File: "a.jpg"}}},
+		},
+		"Кардио": {
+			{ID: "b", Tags: []string{"A_B", "ЭКГ"}, Pages: []Page{{File: "b_000.jpg"}, {File: "b_001.jpg"}}},
+		},
+	}
+	for slug, d := range docs {
+		dir := filepath.Join(baseFotoDir, slug)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for _, doc := range d {
+			for _, p := range doc.Pages {
+				writeFiles(t, dir, map[string]string{p.File: p.File})
+			}
+		}
+		if err := WriteManifest(dir, &Manifest{Documents: d}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, display, err := collectTags(baseFotoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("теги = %q", display)
+	}
+	if n := len(items[tagKey("a b")]); n != 3 {
+		t.Errorf("страниц с тегом «a b» = %d, want 3", n)
+	}
+	if n := len(items[tagKey("экг")]); n != 2 {
+		t.Errorf("страниц с тегом «ЭКГ» = %d, want 2", n)
+	}
+
+	// PDF тегов не попадают в pdf/<slug> ни одной специализации.
+	for _, tag := range display {
+		dir := filepath.Base(filepath.Dir(tagPDFPath(basePDFDir, tag)))
+		if dir == Sanitize(dir) || strings.EqualFold(dir, "tags") {
+			t.Errorf("PDF тега %q в каталоге %q, доступном специализации", tag, dir)
+		}
+	}
+}
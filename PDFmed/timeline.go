@@ -0,0 +1,39 @@
+package main
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// ======== Хронология ========
+
+// timelinePDF — общий PDF со всеми документами всех специализаций по дате.
+const timelinePDF = "all.pdf"
+
+// GenerateTimelinePDF собирает pdf/all.pdf: все документы архива в
+// хронологическом порядке, в колонтитуле — специализация, закладки по годам
+// и месяцам.
+func GenerateTimelinePDF(fotoBase, pdfBase string) error {
+	all, err := selectDocuments(fotoBase, "", time.Time{}, time.Time{})
+	if err != nil {
+		return err
+	}
+	return renderPDF(docItems(fotoBase, all), pdfJob{
+		Title:          "Вся история",
+		Details:        []string{"Все специализации в хронологическом порядке"},
+		Attach:         attachOriginals,
+		AttachConfig:   configAttach,
+		ShowSpec:       true,
+		MonthBookmarks: true,
+		Out:            filepath.Join(pdfBase, timelinePDF),
+	})
+}
+
+// regenerateCombined пересобирает PDF, которые зависят от всего архива:
+// хронологию и PDF по тегам.
+func regenerateCombined(fotoBase, pdfBase string) error {
+	if err := GenerateTimelinePDF(fotoBase, pdfBase); err != nil {
+		return err
+	}
+	return regenerateTags(fotoBase, pdfBase)
+}
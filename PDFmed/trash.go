@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ======== Корзина ========
+
+const trashEntryFile = "entry.json"
+
+// trashEntry — метаданные удалённого документа (.trash/<id>/entry.json).
+type trashEntry struct {
+	Spec      string    `json:"spec"`
+	RemovedAt time.Time `json:"removed_at"`
+	Document  Document  `json:"document"`
+}
+
+func runRemove(args []string) {
+	fs := flag.NewFlagSet("remove", flag.ExitOnError)
+	var (
+		spec    string
+		dateStr string
+		ids     string
+		dryRun  bool
+	)
+	fs.StringVar(&spec, "s", "", "специализация")
+	fs.StringVar(&spec, "spec", "", "специализация")
+	fs.StringVar(&dateStr, "d", "", "дата документа DD-MM-YYYY")
+	fs.StringVar(&dateStr, "date", "", "дата документа DD-MM-YYYY")
+	fs.StringVar(&ids, "id", "", "ID документов из манифеста через запятую")
+	fs.BoolVar(&dryRun, "dry-run", false, "только показать, что будет удалено")
+	patient := patientFlag(fs)
+	_ = fs.Parse(args)
+	usePatient(*patient, false)
+
+	if ids == "" && dateStr == "" && fs.NArg() == 0 {
+		log.Println("Ошибка: укажите пути к файлам, --id или -d (с необязательным -s).")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	var matches []docMatch
+	for _, ref := range fs.Args() {
+		m, err := findDocByPath(baseFotoDir, ref)
+		if err != nil {
+			log.Fatalf("Ошибка: %v", err)
+		}
+		matches = append(matches, m)
+	}
+	for _, id := range splitList(ids) {
+		m, err := findDocByID(baseFotoDir, id)
+		if err != nil {
+			log.Fatalf("Ошибка: %v", err)
+		}
+		matches = append(matches, m)
+	}
+	if dateStr != "" {
+		date, _, err := ParseDate(dateStr)
+		if err != nil {
+			log.Fatalf("Неверный формат даты: %v", err)
+		}
+		specSlug := ""
+		if spec != "" {
+			specSlug = resolveSpec(spec, false).Slug
+		}
+		found, err := selectDocuments(baseFotoDir, specSlug, date, date)
+		if err != nil {
+			log.Fatalf("Ошибка: %v", err)
+		}
+		matches = append(matches, found...)
+	}
+	matches = uniqueMatches(matches)
+	if len(matches) == 0 {
+		log.Println("Подходящих документов не найдено.")
+		return
+	}
+
+	affected := make(map[string]bool)
+	for _, m := range matches {
+		if dryRun {
+			log.Printf("Будет удалён: %s %s %s «%s» (%d стр.)\n", m.Doc.ID, m.Spec, m.Doc.Date, m.Doc.Title, len(m.Doc.Pages))
+			continue
+		}
+		if err := TrashDocument(baseFotoDir, baseTrashDir, m); err != nil {
+			log.Fatalf("Не удалось удалить %s: %v", m.Doc.ID, err)
+		}
+		affected[m.Spec] = true
+		log.Printf("В корзину: %s %s %s «%s»\n", m.Doc.ID, m.Spec, m.Doc.Date, m.Doc.Title)
+	}
+	if dryRun {
+		return
+	}
+	regenerateSpecs(affected)
+	log.Println("Готово. Восстановить: pdfmed restore <id>")
+}
+
+func runRestore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	patient := patientFlag(fs)
+	_ = fs.Parse(args)
+	usePatient(*patient, false)
+	if fs.NArg() == 0 {
+		log.Println("Ошибка: укажите ID документов для восстановления (см. pdfmed trash list).")
+		os.Exit(1)
+	}
+	affected := make(map[string]bool)
+	for _, id := range fs.Args() {
+		e, err := RestoreDocument(baseFotoDir, baseTrashDir, id)
+		if err != nil {
+			log.Fatalf("Не удалось восстановить %s: %v", id, err)
+		}
+		affected[e.Spec] = true
+		log.Printf("Восстановлен: %s %s %s «%s»\n", e.Document.ID, e.Spec, e.Document.Date, e.Document.Title)
+	}
+	regenerateSpecs(affected)
+	log.Println("Готово.")
+}
+
+func runTrash(args []string) {
+	sub := "list"
+	if len(args) > 0 {
+		sub, args = args[0], args[1:]
+	}
+	switch sub {
+	case "list", "ls":
+		fs := flag.NewFlagSet("trash list", flag.ExitOnError)
+		patient := patientFlag(fs)
+		_ = fs.Parse(args)
+		usePatient(*patient, false)
+		entries, err := listTrash(baseTrashDir)
+		if err != nil {
+			log.Fatalf("Не удалось прочитать корзину: %v", err)
+		}
+		if len(entries) == 0 {
+			fmt.Println("Корзина пуста.")
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tСПЕЦИАЛИЗАЦИЯ\tДАТА\tНАЗВАНИЕ\tСТР.\tУДАЛЁН")
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n", e.Document.ID, e.Spec, e.Document.Date, e.Document.Title,
+				len(e.Document.Pages), e.RemovedAt.Local().Format("02-01-2006 15:04"))
+		}
+		_ = tw.Flush()
+	case "empty":
+		fs := flag.NewFlagSet("trash empty", flag.ExitOnError)
+		patient := patientFlag(fs)
+		_ = fs.Parse(args)
+		usePatient(*patient, false)
+		if err := os.RemoveAll(baseTrashDir); err != nil {
+			log.Fatalf("Не удалось очистить корзину: %v", err)
+		}
+		n, err := gcOriginals(baseFotoDir, baseTrashDir, baseOriginalsDir)
+		if err != nil {
+			log.Fatalf("Не удалось очистить неиспользуемые оригиналы: %v", err)
+		}
+		log.Printf("Корзина очищена. Удалено оригиналов: %d\n", n)
+	default:
+		log.Printf("Неизвестная подкоманда trash: %s (ожидается list или empty)\n", sub)
+		os.Exit(1)
+	}
+}
+
+// TrashDocument переносит страницы документа в корзину вместе с его
+// метаданными и удаляет документ из манифеста специализации.
+func TrashDocument(fotoBase, trashBase string, m docMatch) error {
+	dst, err := EnsureUniquePath(filepath.Join(trashBase, m.Doc.ID))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		return err
+	}
+	entry := trashEntry{Spec: m.Spec, RemovedAt: time.Now(), Document: m.Doc}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dst, trashEntryFile), append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	srcDir := m.Dir(fotoBase)
+	for _, p := range m.Doc.Pages {
+		if err := os.Rename(filepath.Join(srcDir, p.File), filepath.Join(dst, p.File)); err != nil {
+			return err
+		}
+	}
+	return UpdateManifest(srcDir, func(man *Manifest) error {
+		man.Documents = removeDocument(man.Documents, m.Doc.ID)
+		return nil
+	})
+}
+
+// RestoreDocument возвращает документ из корзины в его специализацию.
+// При конфликте имён страницы получают суффикс, как в EnsureUniquePath.
+func RestoreDocument(fotoBase, trashBase, id string) (trashEntry, error) {
+	dir := filepath.Join(trashBase, id)
+	var e trashEntry
+	data, err := os.ReadFile(filepath.Join(dir, trashEntryFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return e, fmt.Errorf("в корзине нет документа %s", id)
+		}
+		return e, err
+	}
+	if err := json.Unmarshal(data, &e); err != nil {
+		return e, err
+	}
+	dstDir := filepath.Join(fotoBase, e.Spec)
+	if err := os.MkdirAll(dstDir, 0o755); err != nil {
+		return e, err
+	}
+	for i, p := range e.Document.Pages {
+		dst, err := EnsureUniquePath(filepath.Join(dstDir, p.File))
+		if err != nil {
+			return e, err
+		}
+		if err := os.Rename(filepath.Join(dir, p.File), dst); err != nil {
+			return e, err
+		}
+		e.Document.Pages[i].File = filepath.Base(dst)
+	}
+	err = UpdateManifest(dstDir, func(man *Manifest) error {
+		man.Documents = append(removeDocument(man.Documents, e.Document.ID), e.Document)
+		return nil
+	})
+	if err != nil {
+		return e, err
+	}
+	return e, os.RemoveAll(dir)
+}
+
+func listTrash(trashBase string) ([]trashEntry, error) {
+	dirs, err := os.ReadDir(trashBase)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []trashEntry
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(trashBase, d.Name(), trashEntryFile))
+		if err != nil {
+			log.Printf("Предупреждение: пропуск %s: %v\n", d.Name(), err)
+			continue
+		}
+		var e trashEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			log.Printf("Предупреждение: пропуск %s: %v\n", d.Name(), err)
+			continue
+		}
+		// Каталог может иметь суффикс, если документ удалялся повторно.
+		e.Document.ID = d.Name()
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].RemovedAt.Before(entries[j].RemovedAt) })
+	return entries, nil
+}
+
+func removeDocument(docs []Document, id string) []Document {
+	out := docs[:0]
+	for _, d := range docs {
+		if d.ID != id {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func uniqueMatches(ms []docMatch) []docMatch {
+	seen := make(map[string]bool)
+	out := ms[:0]
+	for _, m := range ms {
+		if seen[m.Doc.ID] {
+			continue
+		}
+		seen[m.Doc.ID] = true
+		out = append(out, m)
+	}
+	return out
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}